@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"sort"
 
 	"git.magenta.dk/os2datascanner/pdfanalyzer/pipeline"
 )
@@ -26,14 +27,36 @@ func main() {
 	}
 	
 	file_name := args[1]
-	pipe, err := pipeline.NewConcurrentPipeline(file_name)
+	// Extract as much text as possible, even from broken documents.
+	pipe, err := pipeline.NewConcurrentPipeline(file_name, true)
 	check(err)
 
-	pipe.Run(
+	err = pipe.Run(
 		pipeline.TextOnlyFilter,
 		pipeline.SimpleExtractor,
 		pipeline.CMapProcessor,
 		pipeline.WritingReducer,
 	)
+	check(err)
+
+	printInfo(pipe.DocumentInfo())
+}
+
+// Print the entries of the document information dictionary, sorted by name.
+func printInfo(info map[string]string) {
+	if len(info) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(info))
+	for key := range info {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Println("Document information:")
+	for _, key := range keys {
+		fmt.Printf(" - %s: %s\n", key, info[key])
+	}
 }
 
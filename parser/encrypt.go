@@ -0,0 +1,564 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdfobjects"
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Padding appended to passwords before deriving keys (revisions 2-4).
+var passwordPadding = []byte{
+	0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41,
+	0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+	0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80,
+	0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+}
+
+// Methods used to encrypt strings and streams.
+type cryptMethod int
+
+const (
+	cryptNone cryptMethod = iota
+	cryptRC4
+	cryptAESV2
+	cryptAESV3
+)
+
+// Standard security handler of an encrypted pdf file.
+//
+// Holds the parameters of the encryption dictionary and the file encryption
+// key derived from the password.
+type securityHandler struct {
+	ref pdftypes.PdfReference
+	revision int
+	length int
+	o []byte
+	u []byte
+	p int32
+	id []byte
+	encryptMetadata bool
+	streamMethod cryptMethod
+	stringMethod cryptMethod
+	key []byte
+}
+
+// Set up decryption if the trailer of `pdf` has an encryption dictionary.
+// Must be called before reading any encrypted objects.
+func (r *PdfReader) readEncryption(pdf *pdfobjects.Pdf) error {
+	value, ok := pdf.Trailer()[pdftypes.ENCRYPT]
+	if !ok {
+		return nil
+	}
+
+	encrypt, err := r.resolve(value)
+	if err != nil {
+		return pdftypes.WithReference(err, pdftypes.ENCRYPTION_ERROR, pdftypes.PdfReference{})
+	}
+
+	dict, ok := encrypt.(pdftypes.PdfDict)
+	if !ok {
+		return pdftypes.Errorf(pdftypes.ENCRYPTION_ERROR, -1, "Invalid encryption dictionary")
+	}
+
+	// Only the first part of the file identifier is used.
+	var id []byte
+	if ids := pdf.ID(); len(ids) > 0 {
+		id = stringBytes(ids[0])
+	}
+
+	security, err := newSecurityHandler(dict, id, r.password)
+	if err != nil {
+		return err
+	}
+
+	// The encryption dictionary itself is not encrypted.
+	security.ref, _ = value.(pdftypes.PdfReference)
+	r.security = security
+
+	return nil
+}
+
+// Set up the security handler described by `dict` and derive the file key
+// from `password`, which may be either the user or the owner password.
+func newSecurityHandler(dict pdftypes.PdfDict, id []byte, password string) (*securityHandler, error) {
+	if filter, _ := dict[pdftypes.FILTER].(pdftypes.PdfName); filter != pdftypes.STANDARD {
+		return nil, pdftypes.Errorf(pdftypes.ENCRYPTION_ERROR, -1, "Unsupported security handler %s", filter)
+	}
+
+	version := dictInt(dict, pdftypes.V, 0)
+	h := &securityHandler{
+		pdftypes.PdfReference{},
+		dictInt(dict, pdftypes.R, 0),
+		dictInt(dict, pdftypes.LENGTH, 40) / 8,
+		dictBytes(dict, pdftypes.O),
+		dictBytes(dict, pdftypes.U),
+		int32(dictInt(dict, pdftypes.P, 0)),
+		id,
+		true,
+		cryptRC4,
+		cryptRC4,
+		nil,
+	}
+
+	if encrypt, ok := dict[pdftypes.ENCRYPTMETADATA].(pdftypes.PdfBool); ok {
+		h.encryptMetadata = bool(encrypt)
+	}
+
+	switch version {
+	case 1:
+		h.length = 5
+	case 2:
+	case 4, 5:
+		var err error
+		if h.streamMethod, err = cryptFilter(dict, pdftypes.STMF); err != nil {
+			return nil, err
+		}
+		if h.stringMethod, err = cryptFilter(dict, pdftypes.STRF); err != nil {
+			return nil, err
+		}
+		h.length = 16
+	default:
+		return nil, pdftypes.Errorf(pdftypes.ENCRYPTION_ERROR, -1, "Unsupported encryption version %d", version)
+	}
+
+	switch h.revision {
+	case 2, 3, 4:
+		h.key = h.authenticate([]byte(password))
+	case 5, 6:
+		h.key = h.authenticateAES([]byte(password), dictBytes(dict, pdftypes.OE), dictBytes(dict, pdftypes.UE))
+	default:
+		return nil, pdftypes.Errorf(pdftypes.ENCRYPTION_ERROR, -1, "Unsupported security handler revision %d", h.revision)
+	}
+
+	if h.key == nil {
+		return nil, pdftypes.NewPdfError(pdftypes.PASSWORD_ERROR, -1, pdftypes.ErrPasswordRequired)
+	}
+
+	return h, nil
+}
+
+// Get the method of the crypt filter named by `key` in `dict`.
+func cryptFilter(dict pdftypes.PdfDict, key pdftypes.PdfName) (cryptMethod, error) {
+	name, ok := dict[key].(pdftypes.PdfName)
+	if !ok || name == pdftypes.IDENTITY {
+		return cryptNone, nil
+	}
+
+	filters, _ := dict[pdftypes.CF].(pdftypes.PdfDict)
+	filter, ok := filters[name].(pdftypes.PdfDict)
+	if !ok {
+		return cryptNone, pdftypes.Errorf(pdftypes.ENCRYPTION_ERROR, -1, "Crypt filter %s not found", name)
+	}
+
+	switch method, _ := filter[pdftypes.CFM].(pdftypes.PdfName); method {
+	case pdftypes.NONE, "":
+		return cryptNone, nil
+	case pdftypes.V2:
+		return cryptRC4, nil
+	case pdftypes.AESV2:
+		return cryptAESV2, nil
+	case pdftypes.AESV3:
+		return cryptAESV3, nil
+	default:
+		return cryptNone, pdftypes.Errorf(pdftypes.ENCRYPTION_ERROR, -1, "Unsupported crypt filter method %s", method)
+	}
+}
+
+// Get the integer value of `key` in `dict`, or `fallback` if it is missing.
+func dictInt(dict pdftypes.PdfDict, key pdftypes.PdfName, fallback int) int {
+	if number, ok := pdftypes.IntValue(dict[key]); ok {
+		return int(number)
+	}
+	return fallback
+}
+
+// Get the bytes of the string value of `key` in `dict`.
+func dictBytes(dict pdftypes.PdfDict, key pdftypes.PdfName) []byte {
+	return stringBytes(dict[key])
+}
+
+// Get the bytes of a literal or hexadecimal string.
+func stringBytes(value pdftypes.PdfDataType) []byte {
+	switch str := value.(type) {
+	case pdftypes.PdfString:
+		return str.Bytes()
+	case pdftypes.PdfHex:
+		data, _ := str.Decode()
+		return data
+	}
+	return nil
+}
+
+// Pad or truncate `password` to 32 bytes.
+func padPassword(password []byte) []byte {
+	padded := make([]byte, 0, 32)
+	if len(password) > 32 {
+		password = password[:32]
+	}
+	padded = append(padded, password...)
+	return append(padded, passwordPadding[:32-len(padded)]...)
+}
+
+// Derive the file key from `password` as the user password (revisions 2-4).
+func (h *securityHandler) computeKey(password []byte) []byte {
+	digest := md5.New()
+	digest.Write(padPassword(password))
+	digest.Write(h.o)
+	digest.Write([]byte{byte(h.p), byte(h.p >> 8), byte(h.p >> 16), byte(h.p >> 24)})
+	digest.Write(h.id)
+	if h.revision >= 4 && !h.encryptMetadata {
+		digest.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+	}
+	key := digest.Sum(nil)
+
+	if h.revision >= 3 {
+		for i := 0; i < 50; i++ {
+			sum := md5.Sum(key[:h.length])
+			key = sum[:]
+		}
+	}
+
+	return key[:h.length]
+}
+
+// Compute the `/U` entry for the file key `key` (revisions 2-4).
+// From revision 3, only the first 16 bytes are significant.
+func (h *securityHandler) computeU(key []byte) []byte {
+	if h.revision == 2 {
+		return rc4Crypt(key, passwordPadding)
+	}
+
+	digest := md5.New()
+	digest.Write(passwordPadding)
+	digest.Write(h.id)
+	data := digest.Sum(nil)
+
+	for i := 0; i < 20; i++ {
+		data = rc4Crypt(xorKey(key, byte(i)), data)
+	}
+
+	return data
+}
+
+// Derive the file key from `password`, trying it as the user password first
+// and as the owner password next. Returns nil if neither matches (revisions 2-4).
+func (h *securityHandler) authenticate(password []byte) []byte {
+	if key := h.checkUserPassword(password); key != nil {
+		return key
+	}
+
+	// The owner password decrypts `/O` to the user password.
+	key := md5.Sum(padPassword(password))
+	ownerKey := key[:]
+	if h.revision >= 3 {
+		for i := 0; i < 50; i++ {
+			sum := md5.Sum(ownerKey)
+			ownerKey = sum[:]
+		}
+	}
+	ownerKey = ownerKey[:h.length]
+
+	user := h.o
+	if h.revision == 2 {
+		user = rc4Crypt(ownerKey, user)
+	} else {
+		for i := 19; i >= 0; i-- {
+			user = rc4Crypt(xorKey(ownerKey, byte(i)), user)
+		}
+	}
+
+	return h.checkUserPassword(user)
+}
+
+// Return the file key if `password` is the user password, or nil otherwise.
+func (h *securityHandler) checkUserPassword(password []byte) []byte {
+	key := h.computeKey(password)
+	u := h.computeU(key)
+
+	n := 32
+	if h.revision >= 3 {
+		n = 16
+	}
+	if len(h.u) < n || !bytes.Equal(u[:n], h.u[:n]) {
+		return nil
+	}
+
+	return key
+}
+
+// Derive the file key from `password`, trying it as the user password first
+// and as the owner password next. Returns nil if neither matches (revisions 5-6).
+func (h *securityHandler) authenticateAES(password []byte, oe []byte, ue []byte) []byte {
+	// Passwords are limited to 127 bytes of UTF-8.
+	if len(password) > 127 {
+		password = password[:127]
+	}
+
+	if len(h.u) < 48 || len(h.o) < 48 {
+		return nil
+	}
+
+	if bytes.Equal(h.hash(password, h.u[32:40], nil), h.u[:32]) {
+		return aesDecryptKey(h.hash(password, h.u[40:48], nil), ue)
+	}
+
+	if bytes.Equal(h.hash(password, h.o[32:40], h.u[:48]), h.o[:32]) {
+		return aesDecryptKey(h.hash(password, h.o[40:48], h.u[:48]), oe)
+	}
+
+	return nil
+}
+
+// Compute the password hash used by revisions 5 and 6.
+// `udata` is the `/U` entry when checking the owner password, nil otherwise.
+func (h *securityHandler) hash(password []byte, salt []byte, udata []byte) []byte {
+	digest := sha256.New()
+	digest.Write(password)
+	digest.Write(salt)
+	digest.Write(udata)
+	key := digest.Sum(nil)
+
+	if h.revision == 5 {
+		return key
+	}
+
+	for i := 0; ; i++ {
+		block := make([]byte, 0, len(password)+len(key)+len(udata))
+		block = append(block, password...)
+		block = append(block, key...)
+		block = append(block, udata...)
+
+		data := bytes.Repeat(block, 64)
+		c, _ := aes.NewCipher(key[:16])
+		cipher.NewCBCEncrypter(c, key[16:32]).CryptBlocks(data, data)
+
+		// The sum of the first 16 bytes modulo 3 selects the next hash function.
+		sum := 0
+		for _, b := range data[:16] {
+			sum += int(b)
+		}
+
+		var next hash.Hash
+		switch sum % 3 {
+		case 0:
+			next = sha256.New()
+		case 1:
+			next = sha512.New384()
+		default:
+			next = sha512.New()
+		}
+		next.Write(data)
+		key = next.Sum(nil)
+
+		if i >= 63 && int(data[len(data)-1]) <= i+1-32 {
+			break
+		}
+	}
+
+	return key[:32]
+}
+
+// Decrypt the file key stored in `/UE` or `/OE` using `key`.
+func aesDecryptKey(key []byte, encrypted []byte) []byte {
+	if len(encrypted) < 32 {
+		return nil
+	}
+
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil
+	}
+
+	data := make([]byte, 32)
+	cipher.NewCBCDecrypter(c, make([]byte, aes.BlockSize)).CryptBlocks(data, encrypted[:32])
+
+	return data
+}
+
+// Encrypt or decrypt `data` with RC4 using `key`.
+func rc4Crypt(key []byte, data []byte) []byte {
+	c, _ := rc4.NewCipher(key)
+	out := make([]byte, len(data))
+	c.XORKeyStream(out, data)
+	return out
+}
+
+// Return a copy of `key` with every byte xor'ed with `value`.
+func xorKey(key []byte, value byte) []byte {
+	out := make([]byte, len(key))
+	for i, b := range key {
+		out[i] = b ^ value
+	}
+	return out
+}
+
+// Decrypt AES-CBC encrypted `data`, where the first block is the
+// initialisation vector, and remove the padding.
+func aesDecrypt(key []byte, data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+
+	if len(data) < 2*aes.BlockSize {
+		return nil, pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "Encrypted data is too short")
+	}
+
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, pdftypes.NewPdfError(pdftypes.DECODE_ERROR, -1, err)
+	}
+
+	// Data that is not a whole number of blocks is truncated.
+	iv := data[:aes.BlockSize]
+	data = data[aes.BlockSize:]
+	data = data[:len(data)-len(data)%aes.BlockSize]
+
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(c, iv).CryptBlocks(out, data)
+
+	if n := int(out[len(out)-1]); n > 0 && n <= aes.BlockSize && bytes.Count(out[len(out)-n:], out[len(out)-n:len(out)-n+1]) == n {
+		out = out[:len(out)-n]
+	}
+
+	return out, nil
+}
+
+// Get the key used for the object `ref` with `method`.
+func (h *securityHandler) objectKey(ref pdftypes.PdfReference, method cryptMethod) []byte {
+	if method == cryptAESV3 {
+		return h.key
+	}
+
+	digest := md5.New()
+	digest.Write(h.key)
+	digest.Write([]byte{
+		byte(ref.Object),
+		byte(ref.Object >> 8),
+		byte(ref.Object >> 16),
+		byte(ref.Generation),
+		byte(ref.Generation >> 8),
+	})
+	if method == cryptAESV2 {
+		digest.Write([]byte("sAlT"))
+	}
+
+	n := len(h.key) + 5
+	if n > 16 {
+		n = 16
+	}
+
+	return digest.Sum(nil)[:n]
+}
+
+// Decrypt `data` belonging to the object `ref` using `method`.
+func (h *securityHandler) decrypt(ref pdftypes.PdfReference, method cryptMethod, data []byte) ([]byte, error) {
+	switch method {
+	case cryptRC4:
+		return rc4Crypt(h.objectKey(ref, method), data), nil
+	case cryptAESV2, cryptAESV3:
+		return aesDecrypt(h.objectKey(ref, method), data)
+	default:
+		return data, nil
+	}
+}
+
+// Decrypt the strings in `value`, which belongs to the object `ref`.
+func (h *securityHandler) decryptValue(ref pdftypes.PdfReference, value pdftypes.PdfDataType) (pdftypes.PdfDataType, error) {
+	switch v := value.(type) {
+	case pdftypes.PdfString:
+		data, err := h.decrypt(ref, h.stringMethod, v.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		return pdftypes.NewPdfString(data), nil
+
+	case pdftypes.PdfHex:
+		encrypted, err := v.Decode()
+		if err != nil {
+			return nil, err
+		}
+		data, err := h.decrypt(ref, h.stringMethod, encrypted)
+		if err != nil {
+			return nil, err
+		}
+		return pdftypes.PdfHex(hex.EncodeToString(data)), nil
+
+	case pdftypes.PdfArray:
+		array := make(pdftypes.PdfArray, len(v))
+		for i, element := range v {
+			decrypted, err := h.decryptValue(ref, element)
+			if err != nil {
+				return nil, err
+			}
+			array[i] = decrypted
+		}
+		return array, nil
+
+	case pdftypes.PdfDict:
+		dict := make(pdftypes.PdfDict, len(v))
+		for key, element := range v {
+			decrypted, err := h.decryptValue(ref, element)
+			if err != nil {
+				return nil, err
+			}
+			dict[key] = decrypted
+		}
+		return dict, nil
+	}
+
+	return value, nil
+}
+
+// Decrypt the strings and stream of `pobj` in place.
+//
+// The encryption dictionary, cross-reference streams and, unless
+// `/EncryptMetadata` is set, metadata streams are not encrypted.
+func (h *securityHandler) decryptObject(pobj *pdfobjects.PdfObject) error {
+	ref := pobj.Reference()
+	if ref == h.ref || pobj.GetType() == pdftypes.XREFSTREAM {
+		return nil
+	}
+
+	value, err := h.decryptValue(ref, pobj.Value())
+	if err != nil {
+		return pdftypes.WithReference(err, pdftypes.DECODE_ERROR, ref)
+	}
+	pobj.SetValue(value)
+
+	if pobj.GetType() == pdftypes.METADATA && !h.encryptMetadata {
+		return nil
+	}
+
+	// Streams loaded on demand are decrypted whenever they are loaded.
+	if stream := pobj.Stream; stream.IsLazy() {
+		pobj.Stream = pdfobjects.NewLazyPdfStream("Stream", func() ([]byte, error) {
+			data, err := stream.Load()
+			if err != nil {
+				return nil, err
+			}
+			return h.decrypt(ref, h.streamMethod, data)
+		})
+		return nil
+	}
+
+	if len(pobj.Stream.Content()) == 0 {
+		return nil
+	}
+
+	data, err := h.decrypt(ref, h.streamMethod, pobj.Stream.Content())
+	if err != nil {
+		return pdftypes.WithReference(err, pdftypes.DECODE_ERROR, ref)
+	}
+	pobj.Stream = pdfobjects.NewPdfStream("Stream", data)
+
+	return nil
+}
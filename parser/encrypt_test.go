@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdfobjects"
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Samples encrypted with user password "user" and owner password "owner".
+// The page content and the /Title of the info dictionary are encrypted.
+var ENCRYPTED_SAMPLES = []struct {
+	file     string
+	revision int
+}{
+	{"rc4-40-r2.pdf", 2},
+	{"rc4-128-r3.pdf", 3},
+	{"rc4-128-r4.pdf", 4},
+	{"aes-128-r4.pdf", 4},
+	{"aes-256-r5.pdf", 5},
+	{"aes-256-r6.pdf", 6},
+}
+
+const SAMPLE_TEXT = "(Secret text here) Tj"
+const SAMPLE_TITLE = "Hemmelig titel"
+
+func readEncrypted(t *testing.T, file string, password string) (*PdfReader, *pdfobjects.Pdf, error) {
+	t.Helper()
+
+	reader, err := NewPdfReader(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatalf("%s: %v", file, err)
+	}
+	reader.SetPassword(password)
+
+	pdf, err := reader.ReadAll()
+	return reader, pdf, err
+}
+
+func TestDecryptWithPassword(t *testing.T) {
+	for _, sample := range ENCRYPTED_SAMPLES {
+		for _, password := range []string{"user", "owner"} {
+			reader, pdf, err := readEncrypted(t, sample.file, password)
+			if err != nil {
+				t.Errorf("%s with %q: %v", sample.file, password, err)
+				continue
+			}
+			reader.Close()
+
+			if reader.security == nil || reader.security.revision != sample.revision {
+				t.Errorf("%s: expected revision %d", sample.file, sample.revision)
+			}
+
+			found := false
+			for i := 0; i < pdf.Count(); i++ {
+				obj, err := pdf.ObjectAt(i)
+				if err != nil || !obj.HasStream() {
+					continue
+				}
+				data, err := obj.DecodeStream()
+				if err != nil {
+					t.Errorf("%s: %v", sample.file, err)
+					continue
+				}
+				found = found || bytes.Contains(data, []byte(SAMPLE_TEXT))
+			}
+			if !found {
+				t.Errorf("%s with %q: page content not decrypted", sample.file, password)
+			}
+
+			info_ref, ok := pdf.Info()
+			if !ok {
+				t.Errorf("%s: no info dictionary", sample.file)
+				continue
+			}
+			info, err := pdf.GetObject(info_ref)
+			if err != nil {
+				t.Errorf("%s: %v", sample.file, err)
+				continue
+			}
+			title, err := info.Dict().GetString(pdftypes.NewPdfName("/Title"), pdf)
+			if err != nil || string(title) != SAMPLE_TITLE {
+				t.Errorf("%s with %q: title %q, %v", sample.file, password, title, err)
+			}
+		}
+	}
+}
+
+func TestDecryptWrongPassword(t *testing.T) {
+	for _, sample := range ENCRYPTED_SAMPLES {
+		for _, password := range []string{"", "wrong"} {
+			reader, _, err := readEncrypted(t, sample.file, password)
+			reader.Close()
+
+			var pdf_err *pdftypes.PdfError
+			if !errors.As(err, &pdf_err) || pdf_err.Kind != pdftypes.PASSWORD_ERROR {
+				t.Errorf("%s with %q: expected password error, got %v", sample.file, password, err)
+			}
+			if !errors.Is(err, pdftypes.ErrPasswordRequired) {
+				t.Errorf("%s with %q: expected ErrPasswordRequired, got %v", sample.file, password, err)
+			}
+		}
+	}
+}
+
+// Hexadecimal strings with white-space or an odd number of digits decrypt
+// like the same string written with an even number of digits.
+func TestDecryptHexString(t *testing.T) {
+	reader, _, err := readEncrypted(t, "rc4-40-r2.pdf", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.Close()
+
+	ref := pdftypes.PdfReference{Object: 6}
+	expected, err := reader.security.decryptValue(ref, pdftypes.PdfHex("4a6b70"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range []pdftypes.PdfHex{"4a 6b\n70", "4a6b7", "4A 6B 7"} {
+		decrypted, err := reader.security.decryptValue(ref, value)
+		if err != nil || decrypted != expected {
+			t.Errorf("%q: got %v, %v, expected %v", value, decrypted, err, expected)
+		}
+	}
+}
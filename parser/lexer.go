@@ -0,0 +1,355 @@
+package parser
+
+import (
+	"io"
+	"strings"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Kinds of tokens produced by the lexer.
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenName
+	tokenNumber
+	tokenString
+	tokenHex
+	tokenDictBegin
+	tokenDictEnd
+	tokenArrayBegin
+	tokenArrayEnd
+	tokenKeyword
+)
+
+// Stringer implementation for tokenKind.
+func (k tokenKind) String() string {
+	switch k {
+	case tokenEOF:
+		return "EOF"
+	case tokenName:
+		return "name"
+	case tokenNumber:
+		return "number"
+	case tokenString:
+		return "string"
+	case tokenHex:
+		return "hexadecimal string"
+	case tokenDictBegin:
+		return "<<"
+	case tokenDictEnd:
+		return ">>"
+	case tokenArrayBegin:
+		return "["
+	case tokenArrayEnd:
+		return "]"
+	default:
+		return "keyword"
+	}
+}
+
+// A single token of pdf syntax.
+//
+// `value` holds the source text of the token, except for hexadecimal strings,
+// where it holds the hexadecimal digits between the brackets.
+type token struct {
+	kind tokenKind
+	value string
+	offset int64
+}
+
+// Check whether the token is the keyword `keyword`.
+func (t token) is(keyword string) bool {
+	return t.kind == tokenKeyword && t.value == keyword
+}
+
+// Stringer implementation for token.
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return t.kind.String()
+	}
+	return t.value
+}
+
+// Source of bytes for the lexer.
+type byteReader interface {
+	io.Reader
+	ReadByte() (byte, error)
+	Peek(n int) ([]byte, error)
+}
+
+// Lexer for pdf syntax.
+//
+// Splits the bytes of `reader` into tokens. Tokens can be looked at before
+// they are consumed, which is needed to recognise references.
+type lexer struct {
+	reader byteReader
+	offset int64
+	buffer []token
+}
+
+// Construct a new lexer reading from `reader`, which is positioned at `offset`.
+func newLexer(reader byteReader, offset int64) *lexer {
+	return &lexer{
+		reader,
+		offset,
+		make([]token, 0),
+	}
+}
+
+// Continue reading from `reader` at `offset`. Tokens read ahead are discarded.
+func (l *lexer) reset(reader byteReader, offset int64) {
+	l.reader = reader
+	l.offset = offset
+	l.buffer = l.buffer[:0]
+}
+
+// Consume and return the next token.
+func (l *lexer) next() (token, error) {
+	if len(l.buffer) > 0 {
+		t := l.buffer[0]
+		l.buffer = l.buffer[1:]
+		return t, nil
+	}
+
+	return l.lex()
+}
+
+// Return the `n`th next token without consuming it.
+func (l *lexer) peek(n int) (token, error) {
+	for len(l.buffer) <= n {
+		t, err := l.lex()
+		if err != nil {
+			return t, err
+		}
+		l.buffer = append(l.buffer, t)
+	}
+
+	return l.buffer[n], nil
+}
+
+// Read a single byte. Must not be used while tokens are read ahead.
+func (l *lexer) readByte() (byte, error) {
+	b, err := l.reader.ReadByte()
+	if err == nil {
+		l.offset++
+	}
+	return b, err
+}
+
+// Read exactly `n` bytes. Must not be used while tokens are read ahead.
+func (l *lexer) readFull(n int) ([]byte, error) {
+	buffer := make([]byte, n)
+	read, err := io.ReadFull(l.reader, buffer)
+	l.offset += int64(read)
+	return buffer, err
+}
+
+// Look at the next `n` bytes without consuming them.
+func (l *lexer) peekBytes(n int) ([]byte, error) {
+	return l.reader.Peek(n)
+}
+
+// Check whether `b` is a whitespace character.
+func isWhitespace(b byte) bool {
+	switch b {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+// Check whether `b` is a delimiter character.
+func isDelimiter(b byte) bool {
+	switch b {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// Check whether `b` is a regular character, i.e. part of a name,
+// number or keyword.
+func isRegular(b byte) bool {
+	return !isWhitespace(b) && !isDelimiter(b)
+}
+
+// Check whether `str` has the syntax of a pdf number.
+func isNumber(str string) bool {
+	digits, dots := 0, 0
+
+	for i := 0; i < len(str); i++ {
+		switch c := str[i]; {
+		case c >= '0' && c <= '9':
+			digits++
+		case c == '.':
+			dots++
+		case (c == '+' || c == '-') && i == 0:
+		default:
+			return false
+		}
+	}
+
+	return digits > 0 && dots <= 1
+}
+
+// Skip whitespace and comments.
+func (l *lexer) skipWhitespace() error {
+	comment := false
+
+	for {
+		peek, err := l.peekBytes(1)
+		if err != nil {
+			return err
+		}
+
+		b := peek[0]
+		if comment {
+			comment = b != '\r' && b != '\n'
+		} else if b == '%' {
+			comment = true
+		} else if !isWhitespace(b) {
+			return nil
+		}
+
+		l.readByte()
+	}
+}
+
+// Read a run of regular characters.
+func (l *lexer) readRegular() (string, error) {
+	var builder strings.Builder
+
+	for {
+		peek, err := l.peekBytes(1)
+		if err == io.EOF {
+			return builder.String(), nil
+		} else if err != nil {
+			return "", pdftypes.NewPdfError(pdftypes.IO_ERROR, l.offset, err)
+		}
+
+		if !isRegular(peek[0]) {
+			return builder.String(), nil
+		}
+
+		l.readByte()
+		builder.WriteByte(peek[0])
+	}
+}
+
+// Read the remainder of a literal string, keeping its source text.
+// Balanced parentheses and escaped characters are part of the string.
+func (l *lexer) readLiteral() (string, error) {
+	var builder strings.Builder
+	builder.WriteByte('(')
+	depth := 1
+
+	for depth > 0 {
+		b, err := l.readByte()
+		if err == io.EOF {
+			return "", pdftypes.Errorf(pdftypes.SYNTAX_ERROR, l.offset, "Unterminated string")
+		} else if err != nil {
+			return "", pdftypes.NewPdfError(pdftypes.IO_ERROR, l.offset, err)
+		}
+
+		builder.WriteByte(b)
+
+		switch b {
+		case '\\':
+			escaped, err := l.readByte()
+			if err != nil {
+				return "", pdftypes.Errorf(pdftypes.SYNTAX_ERROR, l.offset, "Unterminated string")
+			}
+			builder.WriteByte(escaped)
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+	}
+
+	return builder.String(), nil
+}
+
+// Read the remainder of a hexadecimal string and return its digits.
+func (l *lexer) readHex() (string, error) {
+	var builder strings.Builder
+
+	for {
+		b, err := l.readByte()
+		if err == io.EOF {
+			return "", pdftypes.Errorf(pdftypes.SYNTAX_ERROR, l.offset, "Unterminated hexadecimal string")
+		} else if err != nil {
+			return "", pdftypes.NewPdfError(pdftypes.IO_ERROR, l.offset, err)
+		}
+
+		if b == '>' {
+			return builder.String(), nil
+		} else if !isWhitespace(b) {
+			builder.WriteByte(b)
+		}
+	}
+}
+
+// Read the next token from the underlying reader.
+func (l *lexer) lex() (token, error) {
+	err := l.skipWhitespace()
+	if err == io.EOF {
+		return token{tokenEOF, "", l.offset}, nil
+	} else if err != nil {
+		return token{}, pdftypes.NewPdfError(pdftypes.IO_ERROR, l.offset, err)
+	}
+
+	offset := l.offset
+	b, err := l.readByte()
+	if err != nil {
+		return token{}, pdftypes.NewPdfError(pdftypes.IO_ERROR, offset, err)
+	}
+
+	switch b {
+	case '/':
+		name, err := l.readRegular()
+		return token{tokenName, "/" + name, offset}, err
+
+	case '(':
+		str, err := l.readLiteral()
+		return token{tokenString, str, offset}, err
+
+	case '<':
+		if peek, err := l.peekBytes(1); err == nil && peek[0] == '<' {
+			l.readByte()
+			return token{tokenDictBegin, "<<", offset}, nil
+		}
+		hex, err := l.readHex()
+		return token{tokenHex, hex, offset}, err
+
+	case '>':
+		if peek, err := l.peekBytes(1); err == nil && peek[0] == '>' {
+			l.readByte()
+			return token{tokenDictEnd, ">>", offset}, nil
+		}
+		return token{}, pdftypes.Errorf(pdftypes.SYNTAX_ERROR, offset, "Unexpected '>'")
+
+	case '[':
+		return token{tokenArrayBegin, "[", offset}, nil
+
+	case ']':
+		return token{tokenArrayEnd, "]", offset}, nil
+
+	case '{', '}':
+		// Braces only delimit PostScript calculator functions.
+		return token{tokenKeyword, string(b), offset}, nil
+
+	case ')':
+		return token{}, pdftypes.Errorf(pdftypes.SYNTAX_ERROR, offset, "Unbalanced ')'")
+	}
+
+	rest, err := l.readRegular()
+	value := string(b) + rest
+
+	if isNumber(value) {
+		return token{tokenNumber, value, offset}, err
+	}
+	return token{tokenKeyword, value, offset}, err
+}
@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+// Read all tokens of `input`, up to and including the end of the input.
+func lexAll(t *testing.T, input string) []token {
+	t.Helper()
+
+	l := newLexer(bufio.NewReader(strings.NewReader(input)), 0)
+	tokens := make([]token, 0)
+	for {
+		tok, err := l.next()
+		if err != nil {
+			t.Fatalf("%q: %v", input, err)
+		}
+		tokens = append(tokens, tok)
+		if tok.kind == tokenEOF {
+			return tokens
+		}
+	}
+}
+
+func TestLexTokens(t *testing.T) {
+	input := "1 0 obj\n<</Type /Page/Kids[2 0 R]>> % comment\r(a (b) \\) c)<48 6 5>-1.5 +.5 {add} true\nendobj"
+	expected := []token{
+		{tokenNumber, "1", 0},
+		{tokenNumber, "0", 2},
+		{tokenKeyword, "obj", 4},
+		{tokenDictBegin, "<<", 8},
+		{tokenName, "/Type", 10},
+		{tokenName, "/Page", 16},
+		{tokenName, "/Kids", 21},
+		{tokenArrayBegin, "[", 26},
+		{tokenNumber, "2", 27},
+		{tokenNumber, "0", 29},
+		{tokenKeyword, "R", 31},
+		{tokenArrayEnd, "]", 32},
+		{tokenDictEnd, ">>", 33},
+		{tokenString, "(a (b) \\) c)", 46},
+		{tokenHex, "4865", 58},
+		{tokenNumber, "-1.5", 66},
+		{tokenNumber, "+.5", 71},
+		{tokenKeyword, "{", 75},
+		{tokenKeyword, "add", 76},
+		{tokenKeyword, "}", 79},
+		{tokenKeyword, "true", 81},
+		{tokenKeyword, "endobj", 86},
+		{tokenEOF, "", 92},
+	}
+
+	tokens := lexAll(t, input)
+	if len(tokens) != len(expected) {
+		t.Fatalf("Got %d tokens, expected %d: %v", len(tokens), len(expected), tokens)
+	}
+	for i := range expected {
+		if tokens[i] != expected[i] {
+			t.Errorf("Token %d: got %#v, expected %#v", i, tokens[i], expected[i])
+		}
+	}
+}
+
+// Names keep their source text, escapes included, and end at delimiters.
+func TestLexNames(t *testing.T) {
+	tokens := lexAll(t, "/A#20B/C(x)/ /D")
+	expected := []string{"/A#20B", "/C", "(x)", "/", "/D"}
+
+	for i, value := range expected {
+		if tokens[i].value != value {
+			t.Errorf("Token %d: got %q, expected %q", i, tokens[i].value, value)
+		}
+	}
+}
+
+func TestLexNumbers(t *testing.T) {
+	numbers := []string{"0", "123", "-17", "+5", "3.25", "-.002", "4.", "007"}
+	keywords := []string{"-", ".", "1.2.3", "1-2", "--1", "1e5", "R"}
+
+	for _, value := range numbers {
+		if tokens := lexAll(t, value); tokens[0].kind != tokenNumber {
+			t.Errorf("%q: got %v, expected number", value, tokens[0].kind)
+		}
+	}
+	for _, value := range keywords {
+		if tokens := lexAll(t, value); tokens[0].kind != tokenKeyword {
+			t.Errorf("%q: got %v, expected keyword", value, tokens[0].kind)
+		}
+	}
+}
+
+// Tokens can be looked at before they are consumed, as for references.
+func TestLexPeek(t *testing.T) {
+	l := newLexer(bufio.NewReader(strings.NewReader("12 0 R /Next")), 0)
+
+	if tok, err := l.peek(2); err != nil || !tok.is("R") {
+		t.Fatalf("peek(2): got %v, %v", tok, err)
+	}
+	if tok, err := l.peek(0); err != nil || tok.value != "12" {
+		t.Fatalf("peek(0): got %v, %v", tok, err)
+	}
+
+	for _, value := range []string{"12", "0", "R", "/Next"} {
+		if tok, err := l.next(); err != nil || tok.value != value {
+			t.Errorf("Got %v, %v, expected %q", tok, err, value)
+		}
+	}
+	if tok, err := l.next(); err != nil || tok.kind != tokenEOF {
+		t.Errorf("Got %v, %v, expected EOF", tok, err)
+	}
+}
+
+// Tokens read ahead are discarded when the lexer is moved.
+func TestLexReset(t *testing.T) {
+	l := newLexer(bufio.NewReader(strings.NewReader("1 2 3")), 0)
+	l.peek(1)
+
+	l.reset(bufio.NewReader(strings.NewReader("trailer")), 100)
+	if tok, err := l.next(); err != nil || !tok.is("trailer") || tok.offset != 100 {
+		t.Errorf("Got %#v, %v", tok, err)
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	for _, input := range []string{"(abc", "(a\\", "(a(b)", "<414", "> 1", ")"} {
+		l := newLexer(bufio.NewReader(strings.NewReader(input)), 0)
+		if tok, err := l.next(); err == nil {
+			t.Errorf("%q: expected an error, got %v", input, tok)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdfobjects"
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Expand every object stream in `pdf` and append the objects stored in them.
+//
+// Objects the cross-reference table records as stored elsewhere, or that are
+// stored in a superseded object stream, are appended as superseded objects.
+func (r *PdfReader) expandObjectStreams(pdf *pdfobjects.Pdf) error {
+	count := pdf.Count()
+
+	for i := 0; i < count; i++ {
+		pobj, err := pdf.ObjectAt(i)
+		if err != nil {
+			return err
+		}
+
+		if pobj.GetType() != pdftypes.OBJSTM {
+			continue
+		}
+
+		objects, err := r.readObjectStream(pobj)
+		if err != nil {
+			err = pdftypes.WithReference(err, pdftypes.SYNTAX_ERROR, pobj.Reference())
+			if !r.canRepair(err) {
+				return err
+			}
+			pdf.AddRepair("Skipped unreadable object stream", err)
+			continue
+		}
+
+		if err := r.limiter.CheckObjects(pdf.Count() + len(objects)); err != nil {
+			return err
+		}
+
+		for _, obj := range objects {
+			// Objects missing from a rebuilt table are only found in object streams.
+			entry, ok := pdf.XrefEntry(obj.Reference().Object)
+			if !ok || !pobj.IsSuperseded() && entry.Compressed && entry.Stream == pobj.Reference().Object {
+				pdf.AppendObject(obj)
+			} else {
+				pdf.AppendSupersededObject(obj)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Add the objects stored in the object streams of `pdf` to its
+// cross-reference table, unless it already has entries for them.
+//
+// Needed in lazy mode when the table was rebuilt by scanning the file,
+// which only finds the objects stored directly in the file.
+func (r *PdfReader) indexObjectStreams(pdf *pdfobjects.Pdf) error {
+	for _, stream := range r.findObjects(pdf, pdftypes.OBJSTM) {
+		_, numbers, _, err := r.readObjectStreamHeader(stream)
+		if err != nil {
+			err = pdftypes.WithReference(err, pdftypes.SYNTAX_ERROR, stream.Reference())
+			if !r.canRepair(err) {
+				return err
+			}
+			pdf.AddRepair("Skipped unreadable object stream", err)
+			continue
+		}
+
+		if err := r.limiter.CheckObjects(len(pdf.Xref()) + len(numbers)); err != nil {
+			return err
+		}
+
+		for i, number := range numbers {
+			pdf.AddXrefEntry(number, pdfobjects.XrefEntry{
+				InUse: true,
+				Compressed: true,
+				Stream: stream.Reference().Object,
+				Index: i,
+			})
+		}
+	}
+
+	return nil
+}
+
+// Decode an object stream and read its header. Returns the decoded data
+// and the numbers of the objects stored in it with their offsets in the data.
+func (r *PdfReader) readObjectStreamHeader(stream *pdfobjects.PdfObject) ([]byte, []int, []int, error) {
+	dict := stream.Dict()
+
+	count, ok1 := pdftypes.IntValue(dict[pdftypes.N])
+	start, ok2 := pdftypes.IntValue(dict[pdftypes.FIRST])
+	if !ok1 || !ok2 || count < 0 || start < 0 {
+		return nil, nil, nil, pdftypes.Errorf(pdftypes.SYNTAX_ERROR, -1, "Object stream is missing /N or /First")
+	}
+
+	data, err := stream.DecodeStream()
+	if err != nil {
+		return nil, nil, nil, pdftypes.WithReference(err, pdftypes.DECODE_ERROR, stream.Reference())
+	}
+
+	n, first := int(count), int(start)
+	if first > len(data) {
+		return nil, nil, nil, pdftypes.Errorf(pdftypes.SYNTAX_ERROR, -1, "Object stream /First is out of bounds")
+	}
+
+	// The header holds pairs of object numbers and offsets relative to /First.
+	header := strings.Fields(string(data[:first]))
+	if len(header) < 2*n {
+		return nil, nil, nil, pdftypes.Errorf(pdftypes.SYNTAX_ERROR, -1, "Object stream header is truncated")
+	}
+
+	numbers, offsets := make([]int, n), make([]int, n)
+	for i := 0; i < n; i++ {
+		number, err1 := strconv.Atoi(header[2*i])
+		offset, err2 := strconv.Atoi(header[2*i+1])
+		if err1 != nil || err2 != nil || first+offset > len(data) {
+			return nil, nil, nil, pdftypes.Errorf(pdftypes.SYNTAX_ERROR, -1, "Malformed object stream header")
+		}
+		numbers[i], offsets[i] = number, first+offset
+	}
+
+	return data, numbers, offsets, nil
+}
+
+// Decode an object stream and parse the objects stored in it.
+func (r *PdfReader) readObjectStream(stream *pdfobjects.PdfObject) ([]*pdfobjects.PdfObject, error) {
+	data, numbers, offsets, err := r.readObjectStreamHeader(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]*pdfobjects.PdfObject, 0, len(numbers))
+	for i := range numbers {
+		end := len(data)
+		if i+1 < len(offsets) && offsets[i+1] >= offsets[i] {
+			end = offsets[i+1]
+		}
+
+		reader := bufio.NewReader(bytes.NewReader(data[offsets[i]:end]))
+		value, names, err := r.parseObjectValue(newLexer(reader, int64(offsets[i])))
+		if err != nil {
+			return nil, err
+		}
+
+		// Objects in object streams always have generation 0.
+		pobj := pdfobjects.NewPdfObject()
+		pobj.SetReference(pdftypes.PdfReference{Object: numbers[i]})
+		pobj.SetValue(value)
+		pobj.SetRawNames(names)
+		pobj.SetRevision(stream.Revision())
+
+		objects = append(objects, pobj)
+	}
+
+	return objects, nil
+}
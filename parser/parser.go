@@ -1,8 +1,7 @@
 package parser
 
 import (
-	"errors"
-	"fmt"
+	"bytes"
 	"strconv"
 	"strings"
 
@@ -16,271 +15,544 @@ import (
 // This allows for different implementations of parsers with different
 // strategies.
 type PdfParser interface {
-	parseName() pdftypes.PdfName
-	parseString() pdftypes.PdfString
-	parseReference() pdftypes.PdfReference
-	parseNumber() pdftypes.PdfNumber
-	parseArray() pdftypes.PdfArray
-	parseDictionary(line_str string) pdftypes.PdfDict
+	parseName(t token) (pdftypes.PdfName, error)
+	parseString(t token) (pdftypes.PdfString, error)
+	parseReference(t token, l *lexer) (pdftypes.PdfReference, error)
+	parseNumber(t token) (pdftypes.PdfNumber, error)
+	parseArray(l *lexer) (pdftypes.PdfArray, error)
+	parseDictionary(l *lexer) (pdftypes.PdfDict, error)
 }
 
-// Read an object from the file. Panics if EOF is reached.
-func (r *PdfReader) readObject(line_number int) *pdfobjects.PdfObject {
-	var err error = nil;
-	var line []byte;
+// Read an object starting with the object header `N G obj` from the file.
+func (r *PdfReader) readObject() (*pdfobjects.PdfObject, error) {
+	l := r.lexer
 	pobj := pdfobjects.NewPdfObject()
 
-	for !pdftypes.ObjectEnds(string(line)) {
-		line, _, err = r.reader.ReadLine(); 
-		check(err)
-		line_number++
+	if err := r.limiter.CheckDeadline(); err != nil {
+		return nil, err
+	}
 
-		r.dispatch(line, pobj, line_number)
+	ref, err := r.parseObjectHeader(l)
+	if err != nil {
+		return nil, err
 	}
+	pobj.SetReference(ref)
+	pobj.SetTolerantDecoding(r.repair)
+	pobj.SetLimiter(r.limiter)
 
-	return pobj
-}
+	if err := r.readObjectBody(pobj); err != nil {
+		return nil, pdftypes.WithReference(err, pdftypes.SYNTAX_ERROR, ref)
+	}
 
-// Read a stream from the file and insert it into `pobj`.
-// Panics if EOF is reached.
-func (r *PdfReader) readStream(pobj *pdfobjects.PdfObject, line_number int) {
-	var buffer []byte;
-	
-	for !r.reader.IsEndstream() {
-		b, err := r.reader.ReadByte()
-		parserError(err, line_number)
-		buffer = append(buffer, b)
+	if r.security != nil {
+		if err := r.security.decryptObject(pobj); err != nil {
+			return nil, err
+		}
 	}
 
-	pobj.Stream = pdfobjects.NewPdfStream("Stream", buffer)
-}
+	if pobj.HasStream() {
+		r.resolveFilters(pobj)
+	}
 
-// Decide what construct to read next. Either a stream or a dictionary.
-func (r *PdfReader) dispatch(line []byte, pobj *pdfobjects.PdfObject, line_number int) {
-	line_str := string(line)
-	if pdftypes.StreamBegins(line_str) {
-		r.readStream(pobj, line_number)
-	} else if pdftypes.DictBegins(line_str) {
-		tokens := r.tokenizeDict(line_str, line_number)
-		result, _ := r.parseValue(&tokens, line_number)
-
-		dict := result.(pdftypes.PdfDict)
-		
-		pobj.SetDict(dict)
-	} 
+	return pobj, nil
 }
 
-func formatLine(line_str string) string {
-	return strings.ReplaceAll(
-		strings.ReplaceAll(
-			strings.ReplaceAll(
-				strings.ReplaceAll(
-					strings.ReplaceAll(
-						line_str,
-						">>", " >> "),
-					"]", " ] "),
-				"[", " [ "),
-			"/", " /"),
-		"<<", " << ")
-}
+// Read the value and stream of `pobj` following the object header.
+func (r *PdfReader) readObjectBody(pobj *pdfobjects.PdfObject) error {
+	l := r.lexer
 
-func (r *PdfReader) tokenizeDict(line_str string, line_number int) []string {
-	buffer := ""
+	// An object may be empty, in which case its value is null.
+	t, err := l.peek(0)
+	if err != nil {
+		return err
+	}
 
-	buffer += formatLine(line_str)
+	if t.is(pdftypes.ENDOBJECT) {
+		pobj.SetValue(pdftypes.PdfNull(false))
+	} else {
+		value, names, err := r.parseObjectValue(l)
+		if err != nil {
+			return err
+		}
+		pobj.SetValue(value)
+		pobj.SetRawNames(names)
+	}
+
+	t, err = l.next()
+	if err != nil {
+		return err
+	}
 
-	bal_dict := strings.Count(buffer, pdftypes.DICT_BEGIN) - strings.Count(buffer, pdftypes.DICT_END)
+	if t.is(pdftypes.STREAM) {
+		if err := r.readStream(pobj); err != nil {
+			return err
+		}
 
-	for bal_dict != 0 {
-		line, _, err := r.reader.ReadLine()
-		line_number++
-		parserError(err, line_number)
-		line_str = formatLine(string(line))
+		if t, err = l.next(); err != nil {
+			return err
+		}
 
-		buffer += " " + line_str
-		
-		bal_dict += strings.Count(line_str, pdftypes.DICT_BEGIN)
-		bal_dict -= strings.Count(line_str, pdftypes.DICT_END)
+		if t.is(pdftypes.ENDSTREAM) {
+			if t, err = l.next(); err != nil {
+				return err
+			}
+		} else if !r.repair {
+			return unexpectedToken(pdftypes.ENDSTREAM, t)
+		} else {
+			r.pdf.AddRepair("Assumed missing endstream", pdftypes.WithReference(
+				missingDelimiter(pdftypes.ENDSTREAM, t.offset), pdftypes.SYNTAX_ERROR, pobj.Reference()))
+		}
 	}
 
-	tokens := strings.Split(buffer, " ")
+	if !t.is(pdftypes.ENDOBJECT) {
+		if !r.repair {
+			return missingDelimiter(pdftypes.ENDOBJECT, t.offset)
+		}
+		r.pdf.AddRepair("Assumed missing endobj", pdftypes.WithReference(
+			missingDelimiter(pdftypes.ENDOBJECT, t.offset), pdftypes.SYNTAX_ERROR, pobj.Reference()))
+	}
 
-	return tokens
+	return nil
 }
 
-// Read and parse a pdf dictionary from the file and insert is into `pobj`.
-func (r *PdfReader) parseDictionary(tokens *[]string, line_number int) pdftypes.PdfDict {
-	dict := make(pdftypes.PdfDict)
+// Parse an object header `N G obj` and return the reference it declares.
+func (r *PdfReader) parseObjectHeader(l *lexer) (pdftypes.PdfReference, error) {
+	ref := pdftypes.PdfReference{}
 
-	cursor := strings.TrimSpace((*tokens)[0])
+	t, err := l.next()
+	if err != nil {
+		return ref, err
+	}
+	if ref.Object, err = parseInteger(t); err != nil {
+		return ref, err
+	}
 
-	for !pdftypes.DictEnds(cursor) {		
-		key, err := r.parseValue(tokens, line_number)
-		
-		if err != nil {
-			break
-		}
-		
-		value, err := r.parseValue(tokens, line_number)
+	if t, err = l.next(); err != nil {
+		return ref, err
+	}
+	if ref.Generation, err = parseInteger(t); err != nil {
+		return ref, err
+	}
 
-		dict[key] = value
+	if t, err = l.next(); err != nil {
+		return ref, err
+	}
+	if !t.is(pdftypes.OBJECT) {
+		return ref, unexpectedToken(pdftypes.OBJECT, t)
 	}
 
-	return dict
+	return ref, nil
 }
 
-// Dispatch and parse a value of an appropriate PdfDataType
-func (r *PdfReader) parseValue(tokens *[]string, line_number int) (pdftypes.PdfDataType, error) {
-	if len(*tokens) == 0 {
-		return nil, errors.New("Out of tokens")
+// Read a stream from the file and insert it into `pobj`.
+// The reader must be positioned right after the stream keyword.
+//
+// The stream is read using its `/Length`. If the length is missing or is not
+// followed by `endstream`, the stream is scanned for `endstream` instead.
+func (r *PdfReader) readStream(pobj *pdfobjects.PdfObject) error {
+	l := r.lexer
+
+	// The stream keyword is followed by either CRLF or LF.
+	// A single CR is accepted as well, although it is not allowed.
+	if peek, err := l.peekBytes(1); err == nil && peek[0] == '\r' {
+		l.readByte()
+	}
+	if peek, err := l.peekBytes(1); err == nil && peek[0] == '\n' {
+		l.readByte()
 	}
-	
-	head := strings.TrimSpace((*tokens)[0])
 
-	*tokens = (*tokens)[1:]
+	var buffer []byte
+	var err error
+	start := l.offset
 
-	if head == "" {
-		return r.parseValue(tokens, line_number)
+	if length, ok := r.streamLength(pobj, start); ok {
+		// In lazy mode, the data is skipped and read when it is needed.
+		if r.lazy {
+			pobj.Stream = pdfobjects.NewLazyPdfStream("Stream", r.streamLoader(start, length))
+			return r.seek(start + int64(length))
+		}
+		buffer, err = l.readFull(length)
+	} else {
+		buffer, err = r.scanStream()
 	}
 
-	if head == pdftypes.DICT_END {
-		return nil, errors.New("End of dictionary")
+	if err != nil {
+		return parserError(err, l.offset)
 	}
 
-	if head == pdftypes.ARRAY_END {
-		return nil, errors.New("End of array")
-	}
-	
-	if pdftypes.StringBegins(head) {
-		return r.parseString(head, tokens, line_number), nil
-	} else if pdftypes.DictBegins(head) {
-		return r.parseDictionary(tokens, line_number), nil		
-	} else if pdftypes.ArrayBegins(head) {
-		return r.parseArray(tokens, line_number), nil	
-	} else if pdftypes.HexBegins(head) {
-		return r.parseHex(strings.TrimSpace(head), line_number), nil
-	} else if pdftypes.NameBegins(head) {
-		return r.parseName(strings.TrimSpace(head), line_number), nil
-	} else if pdftypes.IsNull(head) {
-		return pdftypes.PdfNull(false), nil
-	} else if pdftypes.IsBool(head) {
-		return r.parseBool(head), nil
+	if r.lazy {
+		pobj.Stream = pdfobjects.NewLazyPdfStream("Stream", r.streamLoader(start, len(buffer)))
 	} else {
-		if pdftypes.IsReference(head, tokens) {
-			return r.parseReference(head, tokens, line_number), nil
-		} else {
-			return r.parseNumber(head, line_number), nil
+		pobj.Stream = pdfobjects.NewPdfStream("Stream", buffer)
+	}
+
+	return nil
+}
+
+// Get a function reading the `length` bytes of stream data at `offset`.
+// It does not move the reader, so it can be used concurrently.
+func (r *PdfReader) streamLoader(offset int64, length int) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		buffer := make([]byte, length)
+		if _, err := r.reader.readAt(buffer, offset); err != nil {
+			return nil, pdftypes.NewPdfError(pdftypes.IO_ERROR, offset, err)
 		}
+		return buffer, nil
 	}
 }
 
-func (r *PdfReader) parseBool(line_str string) pdftypes.PdfBool {
-	if line_str == "true" {
-		return pdftypes.PdfBool(true)
-	} else {
-		return pdftypes.PdfBool(false)
+// Get the `/Length` of the stream of `pobj` starting at `start`.
+// The length is only trusted if it is followed by `endstream`.
+func (r *PdfReader) streamLength(pobj *pdfobjects.PdfObject, start int64) (int, bool) {
+	value, ok := pobj.Dict()[pdftypes.LENGTH]
+	if !ok {
+		return 0, false
 	}
+
+	value, err := r.resolve(value)
+	if err != nil {
+		return 0, false
+	}
+
+	length, ok := pdftypes.IntValue(value)
+	if !ok || length < 0 {
+		return 0, false
+	}
+
+	// An end-of-line marker may precede the endstream keyword.
+	tail := make([]byte, pdftypes.ENDSTREAML+4)
+	n, _ := r.reader.readAt(tail, start+int64(length))
+	tail = bytes.TrimLeft(tail[:n], "\x00\t\n\f\r ")
+
+	return int(length), bytes.HasPrefix(tail, []byte(pdftypes.ENDSTREAM))
 }
 
-// Parse a value of type: PdfName
-func (r *PdfReader) parseName(str string, line_number int) pdftypes.PdfName {
-	trimmed := strings.TrimPrefix(str, " ")
-	if !strings.HasPrefix(trimmed, "/") {
-		unexpectedToken("/", str, line_number)
+// Number of bytes to search for `endstream` at a time.
+const scanWindow = 4096
+
+// Read stream data up to the next `endstream` keyword. The end-of-line
+// marker before the keyword is not part of the data.
+//
+// In repair mode, the data also ends at `endobj` or at the end of the file,
+// in case `endstream` is missing.
+func (r *PdfReader) scanStream() ([]byte, error) {
+	l := r.lexer
+	keyword := []byte(pdftypes.ENDSTREAM)
+	var buffer []byte
+
+	for {
+		peek, err := l.peekBytes(scanWindow)
+		if len(peek) == 0 {
+			if !r.repair {
+				return nil, missingDelimiter(pdftypes.ENDSTREAM, l.offset)
+			}
+			r.pdf.AddRepair("Truncated stream at end of file", missingDelimiter(pdftypes.ENDSTREAM, l.offset))
+			break
+		}
+
+		index := bytes.Index(peek, keyword)
+		if r.repair {
+			if end := bytes.Index(peek, []byte(pdftypes.ENDOBJECT)); end >= 0 && (index < 0 || end < index) {
+				index = end
+			}
+		}
+
+		if index >= 0 {
+			chunk, err := l.readFull(index)
+			if err != nil {
+				return nil, err
+			}
+			buffer = append(buffer, chunk...)
+			break
+		}
+
+		// Keep the last few bytes, in case the keyword is split between windows.
+		n := len(peek)
+		if err == nil {
+			n -= len(keyword) - 1
+		}
+
+		chunk, err := l.readFull(n)
+		if err != nil {
+			return nil, err
+		}
+		buffer = append(buffer, chunk...)
 	}
-	return pdftypes.PdfName(trimmed)
+
+	if bytes.HasSuffix(buffer, []byte("\r\n")) {
+		buffer = buffer[:len(buffer)-2]
+	} else if bytes.HasSuffix(buffer, []byte("\n")) || bytes.HasSuffix(buffer, []byte("\r")) {
+		buffer = buffer[:len(buffer)-1]
+	}
+
+	return buffer, nil
 }
 
-// Parse a value of type: PdfString
-func (r *PdfReader) parseString(head string, tokens *[]string, line_number int) pdftypes.PdfString {
-	buffer := head
+// Dispatch and parse a value of an appropriate PdfDataType
+func (r *PdfReader) parseValue(l *lexer) (pdftypes.PdfDataType, error) {
+	t, err := l.next()
+	if err != nil {
+		return nil, err
+	}
 
-	balance := strings.Count(buffer, pdftypes.STRING_BEGIN) - strings.Count(buffer, pdftypes.STRING_END)
-	if balance != 0 {
-		cursor := strings.TrimSpace((*tokens)[0])
-		buffer += cursor + " "
-	
-		*tokens = (*tokens)[1:]
+	switch t.kind {
+	case tokenDictBegin:
+		return r.parseDictionary(l)
+	case tokenArrayBegin:
+		return r.parseArray(l)
+	case tokenName:
+		return r.parseName(t)
+	case tokenString:
+		return r.parseString(t)
+	case tokenHex:
+		return r.parseHex(t)
+	case tokenNumber:
+		if r.isReference(l) {
+			return r.parseReference(t, l)
+		}
+		return r.parseNumber(t)
+	case tokenKeyword:
+		if pdftypes.IsNull(t.value) {
+			return pdftypes.PdfNull(false), nil
+		} else if pdftypes.IsBool(t.value) {
+			return r.parseBool(t), nil
+		}
+	case tokenEOF:
+		return nil, pdftypes.Errorf(pdftypes.SYNTAX_ERROR, t.offset, "Unexpected end of file")
+	}
+
+	return nil, unexpectedToken("value", t)
+}
+
+// Parse the value of an object. Also returns the source text of the names
+// in it that were written with `#xx` escapes, keyed by the decoded name.
+// Objects read while parsing, e.g. to resolve references, keep their own.
+func (r *PdfReader) parseObjectValue(l *lexer) (pdftypes.PdfDataType, map[pdftypes.PdfName]string, error) {
+	outer := r.names
+	r.names = nil
+	defer func() { r.names = outer }()
+
+	value, err := r.parseValue(l)
+	return value, r.names, err
+}
+
+// Check whether the number just read is the start of a reference,
+// i.e. it is followed by a generation number and `R`.
+func (r *PdfReader) isReference(l *lexer) bool {
+	generation, err1 := l.peek(0)
+	keyword, err2 := l.peek(1)
+
+	return err1 == nil && err2 == nil &&
+		generation.kind == tokenNumber &&
+		keyword.is(pdftypes.REFERENCE_END)
+}
 
-		return r.parseString(buffer, tokens, line_number)
+// Enter an array or dictionary starting at `offset`, checking its depth.
+// Must be followed by `leave` unless an error is returned.
+func (r *PdfReader) enter(offset int64) error {
+	if err := r.limiter.CheckDepth(r.depth + 1); err != nil {
+		if pdf_err, ok := err.(*pdftypes.PdfError); ok {
+			pdf_err.Offset = offset
+		}
+		return err
+	}
+	r.depth++
+	return nil
+}
+
+// Leave an array or dictionary.
+func (r *PdfReader) leave() {
+	r.depth--
+}
+
+// Parse a value of type: PdfDict
+func (r *PdfReader) parseDictionary(l *lexer) (pdftypes.PdfDict, error) {
+	if err := r.enter(l.offset); err != nil {
+		return nil, err
 	}
+	defer r.leave()
+
+	dict := make(pdftypes.PdfDict)
+
+	for {
+		t, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+
+		if t.kind == tokenDictEnd {
+			return dict, nil
+		}
+
+		if t.kind != tokenName {
+			return nil, unexpectedToken(pdftypes.NAME_BEGIN, t)
+		}
+
+		key, err := r.parseName(t)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := r.parseValue(l)
+		if err != nil {
+			return nil, err
+		}
 
-	return pdftypes.PdfString(buffer)	
+		dict[key] = value
+	}
 }
 
 // Parse a value of type: PdfArray
-func (r *PdfReader) parseArray(tokens *[]string, line_number int) pdftypes.PdfArray {
+func (r *PdfReader) parseArray(l *lexer) (pdftypes.PdfArray, error) {
+	if err := r.enter(l.offset); err != nil {
+		return nil, err
+	}
+	defer r.leave()
+
 	array := make(pdftypes.PdfArray, 0)
-	
-	cursor := strings.TrimSpace((*tokens)[0])
 
-	for !pdftypes.ArrayEnds(cursor) {
-		element, err := r.parseValue(tokens, line_number)
+	for {
+		t, err := l.peek(0)
+		if err != nil {
+			return nil, err
+		}
 
+		if t.kind == tokenArrayEnd {
+			l.next()
+			return array, nil
+		}
+
+		element, err := r.parseValue(l)
 		if err != nil {
-			break
+			return nil, err
 		}
-		
+
 		array = append(array, element)
+	}
+}
+
+func (r *PdfReader) parseBool(t token) pdftypes.PdfBool {
+	if t.value == "true" {
+		return pdftypes.PdfBool(true)
+	} else {
+		return pdftypes.PdfBool(false)
+	}
+}
+
+// Parse a value of type: PdfName
+func (r *PdfReader) parseName(t token) (pdftypes.PdfName, error) {
+	if t.kind != tokenName {
+		return "", unexpectedToken(pdftypes.NAME_BEGIN, t)
+	}
+	name := pdftypes.NewPdfName(t.value)
 
-		cursor = strings.TrimSpace((*tokens)[0])
+	// The first spelling of each escaped name is kept.
+	if string(name) != t.value {
+		if r.names == nil {
+			r.names = make(map[pdftypes.PdfName]string)
+		}
+		if _, ok := r.names[name]; !ok {
+			r.names[name] = t.value
+		}
 	}
 
-	*tokens = (*tokens)[1:]
+	return name, nil
+}
 
-	return array
+// Parse a value of type: PdfString
+func (r *PdfReader) parseString(t token) (pdftypes.PdfString, error) {
+	if t.kind != tokenString {
+		return "", unexpectedToken(pdftypes.STRING_BEGIN, t)
+	}
+	return pdftypes.PdfString(t.value), nil
 }
 
 // Parse a value of type: PdfHex
-func (r *PdfReader) parseHex(str string, line_number int) pdftypes.PdfHex {
-	if !pdftypes.HexEnds(str) {
-		missingDelimiter(pdftypes.HEX_END, line_number)
+func (r *PdfReader) parseHex(t token) (pdftypes.PdfHex, error) {
+	if t.kind != tokenHex {
+		return "", unexpectedToken(pdftypes.HEX_BEGIN, t)
 	}
-
-	return pdftypes.PdfHex(
-		strings.TrimSuffix(
-			strings.TrimPrefix(str, pdftypes.HEX_BEGIN),
-			pdftypes.HEX_END,
-		),
-	)
+	return pdftypes.PdfHex(t.value), nil
 }
 
 // Parse a value of type: PdfNumber
-func (r *PdfReader) parseNumber(str string, line_number int) pdftypes.PdfNumber {
-	num, err := strconv.ParseFloat(str, 32)
-	parserError(err, line_number)
-	return pdftypes.PdfNumber(num)
+// Numbers without a decimal point are integers, other numbers are reals.
+func (r *PdfReader) parseNumber(t token) (pdftypes.PdfNumber, error) {
+	if !strings.Contains(t.value, ".") {
+		if num, err := strconv.ParseInt(t.value, 10, 64); err == nil {
+			return pdftypes.PdfInteger(num), nil
+		}
+	}
+
+	num, err := strconv.ParseFloat(t.value, 64)
+	if err != nil {
+		return nil, parserError(err, t.offset)
+	}
+	return pdftypes.PdfReal(num), nil
 }
 
 // Parse a value of type: PdfReference
-func (r *PdfReader) parseReference(head string, tokens *[]string, line_number int) pdftypes.PdfReference {
-	
-	object, err := strconv.Atoi(head)
-	parserError(err, line_number)
-	
-	generation, err := strconv.Atoi((*tokens)[0])
-	parserError(err, line_number)
+// `t` is the object number, the generation and `R` are read from `l`.
+func (r *PdfReader) parseReference(t token, l *lexer) (pdftypes.PdfReference, error) {
+	object, err := parseInteger(t)
+	if err != nil {
+		return pdftypes.PdfReference{}, err
+	}
+
+	t, err = l.next()
+	if err != nil {
+		return pdftypes.PdfReference{}, err
+	}
+
+	generation, err := parseInteger(t)
+	if err != nil {
+		return pdftypes.PdfReference{}, err
+	}
 
-	*tokens = (*tokens)[2:]
+	if t, err = l.next(); err != nil {
+		return pdftypes.PdfReference{}, err
+	}
+
+	if !t.is(pdftypes.REFERENCE_END) {
+		return pdftypes.PdfReference{}, unexpectedToken(pdftypes.REFERENCE_END, t)
+	}
 
 	return pdftypes.PdfReference{
 		Object: object,
 		Generation: generation,
+	}, nil
+}
+
+// Parse a non-negative integer, as used in object headers and
+// cross-reference tables.
+func parseInteger(t token) (int, error) {
+	if t.kind != tokenNumber {
+		return 0, unexpectedToken("integer", t)
+	}
+
+	value, err := strconv.Atoi(t.value)
+	if err != nil || value < 0 {
+		return 0, unexpectedToken("integer", t)
 	}
+
+	return value, nil
 }
 
-// Terminating error handler for ParserError - Unexpected Token.
-func unexpectedToken(expected string, actual string, line_number int) {
-	panic(fmt.Sprintf("ParserError - Unexpected Token at line %d: got %s, expected %s\n", line_number, actual, expected))
+// Error for ParserError - Unexpected Token.
+func unexpectedToken(expected string, actual token) error {
+	return pdftypes.Errorf(pdftypes.SYNTAX_ERROR, actual.offset, "Unexpected token: got %v, expected %s", actual, expected)
 }
 
-// Terminating error handler for ParserError - Missing delimiter.
-func missingDelimiter(missing string, line_number int) {
-	panic(fmt.Sprintf("ParserError - Missing delimiter at line %d: %v\n", line_number, missing))
+// Error for ParserError - Missing delimiter.
+func missingDelimiter(missing string, offset int64) error {
+	return pdftypes.Errorf(pdftypes.SYNTAX_ERROR, offset, "Missing delimiter: %v", missing)
 }
 
-func parserError(err error, line_number int) {
-	if err != nil {
-		panic(fmt.Sprintf("Error at line %d: %v", line_number, err))
+// Error for ParserError - Wraps an error that occurred at `offset`.
+// Errors that are already typed are passed on as they are.
+func parserError(err error, offset int64) error {
+	if _, ok := err.(*pdftypes.PdfError); ok {
+		return err
 	}
+	return pdftypes.NewPdfError(pdftypes.SYNTAX_ERROR, offset, err)
 }
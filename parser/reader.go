@@ -2,9 +2,13 @@ package parser
 
 import (
 	"bufio"
-	"fmt"
+	"bytes"
+	"errors"
 	"io"
 	"os"
+	"sort"
+	"sync"
+
 	"git.magenta.dk/os2datascanner/pdfanalyzer/pdfobjects"
 	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
 )
@@ -12,53 +16,391 @@ import (
 // A Reader for pdf files.
 //
 // Struct for reading pdf files by using and internal `refreshingReader`
+// and a lexer splitting its contents into tokens.
 type PdfReader struct {
-	filename string
+	name string
 	reader *refreshingReader
+	lexer *lexer
+	pdf *pdfobjects.Pdf
+	loading map[pdftypes.PdfReference]bool
+	repair bool
+	scanned *scanIndex
+	password string
+	security *securityHandler
+	lazy bool
+	mutex sync.Mutex
+	objectStream *objectStreamCache
+	limits pdfobjects.Limits
+	limiter *pdfobjects.Limiter
+	depth int
+	entries int
+	names map[pdftypes.PdfName]string
 }
 
-// Constructs a new PdfReader with `filename` and a `refreshingReader`.
+// Constructs a new PdfReader reading the file `filename`.
+// The file is closed once it has been read.
 func NewPdfReader(filename string) (*PdfReader, error) {
-	reader, err := newRefreshingReader(filename)
+	fp, err := os.Open(filename)
+	if err != nil {
+		return nil, pdftypes.NewPdfError(pdftypes.IO_ERROR, -1, err)
+	}
+
+	info, err := fp.Stat()
+	if err != nil {
+		fp.Close()
+		return nil, pdftypes.NewPdfError(pdftypes.IO_ERROR, -1, err)
+	}
+
+	return newPdfReader(filename, newRefreshingReader(fp, info.Size(), fp)), nil
+}
+
+// Constructs a new PdfReader reading `size` bytes from `source`.
+// `name` identifies the document, e.g. in the output of the pipeline.
+// The source is not closed by the reader.
+func NewPdfReaderAt(name string, source io.ReaderAt, size int64) (*PdfReader, error) {
+	if size < 0 {
+		return nil, pdftypes.Errorf(pdftypes.IO_ERROR, -1, "Invalid size %d", size)
+	}
+
+	return newPdfReader(name, newRefreshingReader(source, size, nil)), nil
+}
+
+// Constructs a new PdfReader reading the document held in `data`.
+// `name` identifies the document, e.g. in the output of the pipeline.
+func NewPdfReaderFromBytes(name string, data []byte) (*PdfReader, error) {
+	return NewPdfReaderAt(name, bytes.NewReader(data), int64(len(data)))
+}
+
+// Constructs a new PdfReader with `name` and a `refreshingReader`.
+func newPdfReader(name string, reader *refreshingReader) *PdfReader {
 	return &PdfReader{
-		filename,
+		name,
 		reader,
-	}, err
+		newLexer(reader, 0),
+		nil,
+		make(map[pdftypes.PdfReference]bool),
+		false,
+		nil,
+		"",
+		nil,
+		false,
+		sync.Mutex{},
+		nil,
+		pdfobjects.DefaultLimits(),
+		nil,
+		0,
+		0,
+		nil,
+	}
 }
 
-// In case of error, close `PdfReader` and terminate program.
-func continueOrClose(err error, r *PdfReader) {
-	if err != nil {
-		fmt.Println(err)
-		r.close()
-		os.Exit(-1)
+// Set the password used to open encrypted files. Both the user and the owner
+// password are accepted. Files with an empty user password open without it.
+func (r *PdfReader) SetPassword(password string) {
+	r.password = password
+}
+
+// Enable or disable lazy mode.
+//
+// In lazy mode, `ReadAll` only reads the cross-reference table and trailer.
+// Objects are loaded when they are requested and stream data when it is
+// extracted, so memory use does not grow with the size of the file.
+// The file stays open until `Close` is called.
+func (r *PdfReader) SetLazyMode(lazy bool) {
+	r.lazy = lazy
+}
+
+// Get the name of the document.
+func (r *PdfReader) Name() string {
+	return r.name
+}
+
+// Close the underlying file. Only needed in lazy mode, as the file is
+// otherwise closed once it has been read.
+func (r *PdfReader) Close() {
+	r.close()
+}
+
+// Load the object referenced by `ref` from the file.
+// Implements `pdfobjects.Loader` for documents read in lazy mode.
+func (r *PdfReader) LoadObject(ref pdftypes.PdfReference) (*pdfobjects.PdfObject, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.loadObject(ref)
+}
+
+// Load the version of object `number` located by `entry`, which need not
+// be the one in the cross-reference table of the newest revision.
+// Implements `pdfobjects.Loader` for documents read in lazy mode.
+func (r *PdfReader) LoadEntry(number int, entry pdfobjects.XrefEntry) (*pdfobjects.PdfObject, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ref := pdftypes.PdfReference{Object: number}
+	if !entry.Compressed {
+		ref.Generation = entry.Generation
 	}
+	return r.loadEntry(ref, entry)
+}
+
+// Enable or disable repair mode.
+//
+// In repair mode, problems such as a broken cross-reference table, wrong
+// offsets, missing `endobj`/`endstream` or a truncated file are worked around
+// instead of returned as errors. The repairs made are recorded in the `Pdf`.
+func (r *PdfReader) SetRepairMode(repair bool) {
+	r.repair = repair
+}
+
+// Set the limits on the resources used to read the document, replacing
+// `pdfobjects.DefaultLimits`. Reading stops with an error of kind
+// `LIMIT_ERROR` once a limit is exceeded, also in repair mode.
+func (r *PdfReader) SetLimits(limits pdfobjects.Limits) {
+	r.limits = limits
+}
+
+// Count an entry read from a cross-reference section against the object
+// limit. The entries of all sections count, as all of them are kept.
+func (r *PdfReader) countEntry() error {
+	r.entries++
+	return r.limiter.CheckObjects(r.entries)
+}
+
+// Check whether `err` can be worked around in repair mode.
+// Exceeded limits always end reading.
+func (r *PdfReader) canRepair(err error) bool {
+	return r.repair && !errors.Is(err, pdftypes.ErrLimitExceeded)
 }
 
 // Reads an entire pdf file and return a `Pdf` struct.
-func (r *PdfReader) ReadAll() *pdfobjects.Pdf {
-	pdf := pdfobjects.NewPdf(r.filename)
-	line_number := 0
-
-	// Try parsing objects as long as End-Of-File (EOF) is not reached.
-	for !r.reader.IsEOF() {
-		line, _, err := r.reader.ReadLine()
-		line_number++
-		continueOrClose(err, r)
-		line_str := string(line)
-
-		if pdftypes.ObjectBegins(line_str) {
-			obj := r.readObject(line_number)
-			pdf.AppendObject(obj)
-		} else if pdftypes.IsVersion(line_str) {
-			// Parse PDF version.
-			pdf.SetVersion(line_str)
+// The file is closed afterwards, also in case of error, unless
+// the `Pdf` is read in lazy mode.
+func (r *PdfReader) ReadAll() (*pdfobjects.Pdf, error) {
+	pdf, err := r.read()
+	if err != nil || !r.lazy {
+		r.close()
+	}
+
+	return pdf, err
+}
+
+// Read the file into a new `Pdf`.
+func (r *PdfReader) read() (*pdfobjects.Pdf, error) {
+	pdf := pdfobjects.NewPdf(r.name)
+	r.pdf = pdf
+	r.limiter = pdfobjects.NewLimiter(r.limits)
+	r.entries = 0
+
+	if err := r.readVersion(pdf); err != nil {
+		return nil, err
+	}
+
+	// Use the cross-reference table to locate objects if possible.
+	// In repair mode, it is rebuilt by scanning the file if it is broken.
+	rebuilt := false
+	if err := r.readXref(pdf); err != nil {
+		if !r.canRepair(err) {
+			return nil, err
 		}
+		pdf.AddRepair("Rebuilt cross-reference table", err)
+
+		if err := r.rebuildXref(pdf); err != nil {
+			return nil, err
+		}
+		rebuilt = true
+	}
+
+	if err := r.limiter.CheckObjects(countInUse(pdf)); err != nil {
+		return nil, err
 	}
-	
-	r.close()
 
-	return pdf
+	if err := r.readEncryption(pdf); err != nil {
+		return nil, err
+	}
+
+	if r.lazy {
+		// Objects in object streams are otherwise missing from a rebuilt table.
+		if rebuilt {
+			if err := r.indexObjectStreams(pdf); err != nil {
+				return nil, err
+			}
+		}
+
+		pdf.SetLoader(r, lazyReferences(pdf))
+		for _, superseded := range supersededEntries(pdf) {
+			pdf.AddSupersededEntry(superseded)
+		}
+		if err := r.limiter.CheckObjects(pdf.Count()); err != nil {
+			return nil, err
+		}
+		if r.repair {
+			r.recoverTrailer(pdf)
+		}
+
+		pdf.AnalyzeReachability()
+
+		return pdf, nil
+	}
+
+	if err := r.readIndexedObjects(pdf); err != nil {
+		return nil, err
+	}
+
+	if err := r.readSupersededObjects(pdf); err != nil {
+		return nil, err
+	}
+
+	// Objects stored in object streams are only visible once expanded.
+	if err := r.expandObjectStreams(pdf); err != nil {
+		return nil, err
+	}
+
+	if r.repair {
+		r.recoverTrailer(pdf)
+	}
+
+	pdf.AnalyzeReachability()
+
+	return pdf, nil
+}
+
+// Move the reader to `offset` bytes from the beginning of the file.
+// Tokens read ahead are discarded.
+func (r *PdfReader) seek(offset int64) error {
+	if err := r.reader.seek(offset); err != nil {
+		return pdftypes.NewPdfError(pdftypes.IO_ERROR, offset, err)
+	}
+	r.lexer.reset(r.reader, offset)
+	return nil
+}
+
+// Read every object in use from the offsets recorded in the cross-reference table.
+//
+// In repair mode, objects that cannot be read at their recorded offset are
+// looked for elsewhere in the file, and skipped if they cannot be found.
+func (r *PdfReader) readIndexedObjects(pdf *pdfobjects.Pdf) error {
+	for _, number := range objectNumbers(pdf) {
+		entry, _ := pdf.XrefEntry(number)
+
+		obj, err := r.readObjectAt(entry.Offset, number)
+		if err != nil && r.canRepair(err) {
+			obj, err = r.relocateObject(pdf, number, entry.Offset, err)
+			if err != nil && r.canRepair(err) {
+				pdf.AddRepair("Skipped unreadable object", err)
+				continue
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		obj.SetRevision(introducedIn(pdf, number, entry))
+		pdf.AppendObject(obj)
+	}
+
+	return nil
+}
+
+// Find the objects that older revisions store at other locations than the
+// newest one, i.e. objects that were later replaced or deleted.
+func supersededEntries(pdf *pdfobjects.Pdf) []pdfobjects.SupersededEntry {
+	entries := make([]pdfobjects.SupersededEntry, 0)
+	read := make(map[int64]bool)
+
+	for i := 0; i < pdf.RevisionCount()-1; i++ {
+		rev, _ := pdf.Revision(i)
+
+		for _, number := range sortedNumbers(rev.Updates()) {
+			entry := rev.Updates()[number]
+			if !entry.InUse || entry.Compressed || read[entry.Offset] {
+				continue
+			}
+
+			if current, ok := pdf.XrefEntry(number); ok && current.SameLocation(entry) {
+				continue
+			}
+			read[entry.Offset] = true
+
+			entries = append(entries, pdfobjects.SupersededEntry{
+				Number: number,
+				Revision: i,
+				Entry: entry,
+			})
+		}
+	}
+
+	return entries
+}
+
+// Read the objects that older revisions store at other locations than the
+// newest one, i.e. objects that were later replaced or deleted.
+func (r *PdfReader) readSupersededObjects(pdf *pdfobjects.Pdf) error {
+	for _, superseded := range supersededEntries(pdf) {
+		if err := r.limiter.CheckObjects(pdf.Count() + 1); err != nil {
+			return err
+		}
+
+		obj, err := r.readObjectAt(superseded.Entry.Offset, superseded.Number)
+		if err != nil {
+			if !r.canRepair(err) {
+				return err
+			}
+			pdf.AddRepair("Skipped unreadable superseded object", err)
+			continue
+		}
+
+		obj.SetRevision(superseded.Revision)
+		pdf.AppendSupersededObject(obj)
+	}
+
+	return nil
+}
+
+// Read the object with number `number` located at `offset`.
+func (r *PdfReader) readObjectAt(offset int64, number int) (*pdfobjects.PdfObject, error) {
+	if err := r.seek(offset); err != nil {
+		return nil, err
+	}
+
+	obj, err := r.readObject()
+	if err != nil {
+		return nil, err
+	}
+
+	if obj.Reference().Object != number {
+		return nil, pdftypes.Errorf(pdftypes.XREF_ERROR, offset, "Expected object %d, found object %v", number, obj.Reference())
+	}
+
+	return obj, nil
+}
+
+// Number of bytes at the beginning of the file to search for the header.
+const versionWindow = 1024
+
+// Read the pdf version from the header at the beginning of the file.
+func (r *PdfReader) readVersion(pdf *pdfobjects.Pdf) error {
+	buffer := make([]byte, versionWindow)
+	n, err := r.reader.readAt(buffer, 0)
+	if err != nil && err != io.EOF {
+		return pdftypes.NewPdfError(pdftypes.IO_ERROR, 0, err)
+	}
+	buffer = buffer[:n]
+
+	index := bytes.Index(buffer, []byte(pdftypes.PDF_VERSION))
+	if index < 0 {
+		return nil
+	}
+
+	line := buffer[index:]
+	if end := bytes.IndexAny(line, "\r\n"); end >= 0 {
+		line = line[:end]
+	}
+
+	pdf.SetVersion(string(line))
+
+	return nil
 }
 
 // Close the readers file handle.
@@ -69,44 +411,58 @@ func (r *PdfReader) close() {
 // Internal buffering reader. Reads 4kB at a time to keep memory low.
 // The buffer can be reloaded.
 type refreshingReader struct {
-	fp *os.File
+	source *io.SectionReader
+	closer io.Closer
 	reader *bufio.Reader
 }
 
-// Construct a new refreshingReader with `filename`.
-func newRefreshingReader(filename string) (*refreshingReader, error) {
-	fp, err := os.Open(filename)
-	reader := bufio.NewReader(fp)
+// Construct a new refreshingReader reading `size` bytes from `source`.
+// If `closer` is not nil, it is closed when the reader is closed.
+func newRefreshingReader(source io.ReaderAt, size int64, closer io.Closer) *refreshingReader {
+	section := io.NewSectionReader(source, 0, size)
 	return &refreshingReader{
-		fp,
-		reader,
-	}, err
+		section,
+		closer,
+		bufio.NewReader(section),
+	}
 }
 
-// Read the next 4kB from file into buffer.
+// Move the cursor to `offset` bytes from the beginning of the source.
 // Current buffer is discarded.
-func (r *refreshingReader) reloadBuffer() {
-	r.reader = bufio.NewReader(r.fp)
+func (r *refreshingReader) seek(offset int64) error {
+	if _, err := r.source.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	r.reader.Reset(r.source)
+	return nil
+}
+
+// Get the size of the source in bytes.
+func (r *refreshingReader) size() (int64, error) {
+	return r.source.Size(), nil
+}
+
+// Read `len(buffer)` bytes starting at `offset` without moving the cursor.
+func (r *refreshingReader) readAt(buffer []byte, offset int64) (int, error) {
+	return r.source.ReadAt(buffer, offset)
 }
 
-// Close the file handle.
+// Close the underlying file, if the reader opened it.
 func (r *refreshingReader) close() {
-	r.fp.Close()
+	if r.closer != nil {
+		r.closer.Close()
+		r.closer = nil
+	}
 }
 
-// Get the name of the file.
-func (r *refreshingReader) name() string {
-	return r.fp.Name()
+// Reads up to `len(p)` bytes from the source.
+func (r *refreshingReader) Read(p []byte) (int, error) {
+	return r.reader.Read(p)
 }
 
-// Reads one byte from the file.
+// Reads one byte from the source.
 func (r *refreshingReader) ReadByte() (byte, error) {
-	b, err := r.reader.ReadByte()
-	if err == io.EOF {
-		r.reloadBuffer()
-		return r.ReadByte()
-	}
-	return b, err
+	return r.reader.ReadByte()
 }
 
 // Read `n` bytes without moving the cursor of the reader.
@@ -114,29 +470,45 @@ func (r *refreshingReader) Peek(n int) ([]byte, error) {
 	return r.reader.Peek(n)
 }
 
-// Reads a line from the file.
+// Reads a line from the source.
 func (r *refreshingReader) ReadLine() ([]byte, bool, error) {
 	return r.reader.ReadLine()
 }
 
-// Checks whether the reader has reached End-Of-File (EOF).
-func (r *refreshingReader) IsEOF() bool {
-	peek, err := r.reader.Peek(pdftypes.EOFL)
-	check(err)
-	return pdftypes.IsEOF(string(peek))
-}
+// Get the references of all objects in use, ordered by where they are stored,
+// so that objects sharing an object stream are loaded one after another.
+func lazyReferences(pdf *pdfobjects.Pdf) []pdftypes.PdfReference {
+	xref := pdf.Xref()
+	numbers := make([]int, 0, len(xref))
 
-// Check whether the reader has reached the end of a stream.
-func (r *refreshingReader) IsEndstream() bool {
-	peek, err := r.Peek(pdftypes.ENDSTREAML)
-	check(err)
-	return pdftypes.StreamEnds(string(peek))
-}
+	for number, entry := range xref {
+		if entry.InUse {
+			numbers = append(numbers, number)
+		}
+	}
 
-// In case of error just print the error and panic.
-func check(err error) {
-	if err != nil {
-		fmt.Println(err)
-		panic(err)
+	// Compressed objects are placed at the offset of their object stream.
+	position := func(number int) (int64, int) {
+		entry := xref[number]
+		if !entry.Compressed {
+			return entry.Offset, -1
+		}
+		return xref[entry.Stream].Offset, entry.Index
 	}
+
+	sort.Slice(numbers, func(i, j int) bool {
+		a, x := position(numbers[i])
+		b, y := position(numbers[j])
+		return a < b || a == b && x < y
+	})
+
+	references := make([]pdftypes.PdfReference, len(numbers))
+	for i, number := range numbers {
+		references[i] = pdftypes.PdfReference{Object: number}
+		if entry := xref[number]; !entry.Compressed {
+			references[i].Generation = entry.Generation
+		}
+	}
+
+	return references
 }
@@ -0,0 +1,260 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdfobjects"
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Build a pdf file from the bodies of objects 1, 2, ... with a valid
+// cross-reference table. Object 1 is the catalog.
+func buildPdf(objects ...string) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString("%PDF-1.7\n")
+
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buffer.Len()
+		fmt.Fprintf(&buffer, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buffer.Len()
+	fmt.Fprintf(&buffer, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buffer, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buffer, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return buffer.Bytes()
+}
+
+// Read `data` in eager and lazy mode, with and without repair mode.
+func readModes(t *testing.T, data []byte, check func(mode string, pdf *pdfobjects.Pdf, err error)) {
+	t.Helper()
+
+	for _, lazy := range []bool{false, true} {
+		for _, repair := range []bool{false, true} {
+			reader, err := NewPdfReaderFromBytes("test.pdf", data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader.SetLazyMode(lazy)
+			reader.SetRepairMode(repair)
+
+			pdf, err := reader.ReadAll()
+			check(fmt.Sprintf("lazy %v, repair %v", lazy, repair), pdf, err)
+			reader.Close()
+		}
+	}
+}
+
+// An object stream with fax parameters that used to overflow the bitmap size.
+// The data is only an end-of-block code, so no rows are decoded.
+func TestReadFaxObjectStream(t *testing.T) {
+	data := buildPdf(
+		"<< /Type /Catalog >>",
+		"<< /Type /ObjStm /N 1 /First 4 /Filter /CCITTFaxDecode"+
+			" /DecodeParms << /K -1 /Columns 9223372036854775800 /Rows 16 >> /Length 3 >>\n"+
+			"stream\n\x00\x10\x01\nendstream",
+	)
+
+	readModes(t, data, func(mode string, pdf *pdfobjects.Pdf, err error) {
+		var pdf_err *pdftypes.PdfError
+		if err != nil && !errors.As(err, &pdf_err) {
+			t.Errorf("%s: unexpected error %v", mode, err)
+		}
+		if err == nil && !pdf.IsLazy() && len(pdf.Repairs()) == 0 {
+			t.Errorf("%s: object stream not reported", mode)
+		}
+	})
+}
+
+// Read `data` with `limits` and check that reading fails with a limit error,
+// also in repair mode.
+func checkLimitExceeded(t *testing.T, name string, data []byte, limits pdfobjects.Limits) {
+	t.Helper()
+
+	for _, repair := range []bool{false, true} {
+		reader, err := NewPdfReaderFromBytes("test.pdf", data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader.SetRepairMode(repair)
+		reader.SetLimits(limits)
+
+		_, err = reader.ReadAll()
+
+		var pdf_err *pdftypes.PdfError
+		if !errors.As(err, &pdf_err) || pdf_err.Kind != pdftypes.LIMIT_ERROR || !errors.Is(err, pdftypes.ErrLimitExceeded) {
+			t.Errorf("%s, repair %v: expected limit error, got %v", name, repair, err)
+		}
+	}
+}
+
+func TestReadLimits(t *testing.T) {
+	nested := buildPdf(
+		"<< /Type /Catalog /Nested [[[[[[[[ 1 ]]]]]]]] >>",
+	)
+	checkLimitExceeded(t, "depth", nested, pdfobjects.Limits{MaxDepth: 4})
+
+	objects := buildPdf(
+		"<< /Type /Catalog >>",
+		"1", "2", "3", "4",
+	)
+	checkLimitExceeded(t, "objects", objects, pdfobjects.Limits{MaxObjects: 3})
+
+	stream := buildPdf(
+		"<< /Type /Catalog >>",
+		"<< /Type /ObjStm /N 1 /First 4 /Filter /ASCIIHexDecode /Length 12 >>\nstream\n332030203432\nendstream",
+	)
+	checkLimitExceeded(t, "stream size", stream, pdfobjects.Limits{MaxStreamSize: 4})
+	checkLimitExceeded(t, "decoded bytes", stream, pdfobjects.Limits{MaxDecodedBytes: 4})
+
+	checkLimitExceeded(t, "timeout", objects, pdfobjects.Limits{Timeout: time.Nanosecond})
+
+	// Within the limits, the same files are read.
+	for _, data := range [][]byte{nested, objects, stream} {
+		reader, _ := NewPdfReaderFromBytes("test.pdf", data)
+		reader.SetLimits(pdfobjects.Limits{MaxDepth: 16, MaxObjects: 16, MaxStreamSize: 64, MaxDecodedBytes: 64})
+		if _, err := reader.ReadAll(); err != nil {
+			t.Errorf("Unexpected error within limits: %v", err)
+		}
+	}
+}
+
+// Append an incremental update replacing the objects in `objects` to a file
+// built by `buildPdf`.
+func appendUpdate(data []byte, objects map[int]string) []byte {
+	var previous int
+	fmt.Sscanf(string(data[bytes.LastIndex(data, []byte("startxref")):]), "startxref\n%d", &previous)
+
+	buffer := bytes.NewBuffer(append([]byte(nil), data...))
+	numbers := make([]int, 0, len(objects))
+	offsets := make(map[int]int)
+	for number := 1; len(numbers) < len(objects); number++ {
+		if object, ok := objects[number]; ok {
+			numbers = append(numbers, number)
+			offsets[number] = buffer.Len()
+			fmt.Fprintf(buffer, "%d 0 obj\n%s\nendobj\n", number, object)
+		}
+	}
+
+	xref := buffer.Len()
+	buffer.WriteString("xref\n")
+	for _, number := range numbers {
+		fmt.Fprintf(buffer, "%d 1\n%010d 00000 n \n", number, offsets[number])
+	}
+	fmt.Fprintf(buffer, "trailer\n<< /Size %d /Root 1 0 R /Prev %d >>\nstartxref\n%d\n%%%%EOF\n", numbers[len(numbers)-1]+1, previous, xref)
+
+	return buffer.Bytes()
+}
+
+func textStream(text string) string {
+	content := "BT (" + text + ") Tj ET"
+	return fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content)
+}
+
+// Superseded objects are found in lazy mode as in eager mode.
+func TestReadSupersededObjects(t *testing.T) {
+	data := appendUpdate(
+		buildPdf("<< /Type /Catalog /Contents 2 0 R >>", textStream("old text")),
+		map[int]string{2: textStream("new text")},
+	)
+
+	readModes(t, data, func(mode string, pdf *pdfobjects.Pdf, err error) {
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		if pdf.Count() != 3 || pdf.RevisionCount() != 2 {
+			t.Fatalf("%s: %d objects in %d revisions, expected 3 in 2", mode, pdf.Count(), pdf.RevisionCount())
+		}
+
+		found := false
+		for i := 0; i < pdf.Count(); i++ {
+			obj, err := pdf.ObjectAt(i)
+			if err != nil {
+				t.Fatalf("%s: %v", mode, err)
+			}
+			if !obj.IsSuperseded() {
+				continue
+			}
+			data, _ := obj.DecodeStream()
+			found = found || bytes.Contains(data, []byte("old text")) && obj.Revision() == 0 &&
+				obj.Reachability() == pdfobjects.SUPERSEDED
+		}
+		if !found {
+			t.Errorf("%s: superseded object not found", mode)
+		}
+
+		for n, text := range []string{"old text", "new text"} {
+			rev, _ := pdf.Revision(n)
+			obj, err := rev.GetObject(pdftypes.PdfReference{Object: 2})
+			if err != nil {
+				t.Errorf("%s: %v", mode, err)
+				continue
+			}
+			if data, _ := obj.DecodeStream(); !bytes.Contains(data, []byte(text)) {
+				t.Errorf("%s: revision %d has %q, expected %q", mode, n, data, text)
+			}
+			if objects := rev.Objects(); len(objects) != 2 {
+				t.Errorf("%s: %d objects at revision %d, expected 2", mode, len(objects), n)
+			}
+		}
+	})
+}
+
+// Escaped names match the constants, and their source text is kept,
+// also for objects in object streams.
+func TestReadEscapedNames(t *testing.T) {
+	content := "BT (escaped) Tj ET"
+	data := buildPdf(
+		"<< /Type /Catalog >>",
+		fmt.Sprintf("<< /Filter /ASCIIHex#44ecode /Length %d >>\nstream\n%x>\nendstream", 2*len(content)+1, content),
+		"<< /Type /ObjStm /N 1 /First 4 /Length 25 >>\nstream\n4 0 << /Font#20Name /F#31 >>\nendstream",
+	)
+
+	readModes(t, data, func(mode string, pdf *pdfobjects.Pdf, err error) {
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+
+		stream, err := pdf.GetObject(pdftypes.PdfReference{Object: 2})
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		if decoded, err := stream.DecodeStream(); err != nil || string(decoded) != content {
+			t.Errorf("%s: decoded %q, %v", mode, decoded, err)
+		}
+		if raw := stream.RawName(pdftypes.ASCIIHEXDECODE); raw != "/ASCIIHex#44ecode" {
+			t.Errorf("%s: raw name %q", mode, raw)
+		}
+		if raw := stream.RawName(pdftypes.LENGTH); raw != "/Length" {
+			t.Errorf("%s: raw name %q", mode, raw)
+		}
+
+		// Without a cross-reference stream, only eager mode expands the object stream.
+		if pdf.IsLazy() {
+			return
+		}
+
+		obj, err := pdf.GetObject(pdftypes.PdfReference{Object: 4})
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		name := pdftypes.NewPdfName("/Font Name")
+		if value, _ := obj.Dict().Get(name); value != pdftypes.NewPdfName("/F1") {
+			t.Errorf("%s: %v", mode, obj.Dict())
+		}
+		if raw := obj.RawName(name); raw != "/Font#20Name" {
+			t.Errorf("%s: raw name %q", mode, raw)
+		}
+		if raw := obj.RawName(pdftypes.NewPdfName("/F1")); raw != "/F#31" {
+			t.Errorf("%s: raw name %q", mode, raw)
+		}
+	})
+}
@@ -0,0 +1,305 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdfobjects"
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Locations of object headers and the trailer found by scanning the file.
+// `typed` holds the numbers of the objects declaring one of `scannedTypes`,
+// in the order they occur in the file.
+type scanIndex struct {
+	objects map[int]pdfobjects.XrefEntry
+	trailer int64
+	typed map[pdftypes.PdfName][]int
+}
+
+// Number of bytes to scan for object headers at a time.
+const repairWindow = 1 << 20
+
+// Number of bytes shared by consecutive windows, so that headers split
+// between two windows are still found.
+const repairOverlap = 64
+
+// Pattern matching an object header `N G obj`.
+var headerPattern = regexp.MustCompile(`(\d+)[\x00\t\n\f\r ]+(\d+)[\x00\t\n\f\r ]+obj`)
+
+// Pattern matching the `/Type` entries of the objects repairs look for.
+var typePattern = regexp.MustCompile(`/Type[\x00\t\n\f\r ]*(/Catalog|/ObjStm|/XRef)`)
+
+// Scan the whole file for object headers and the `trailer` keyword.
+// The result is computed once and reused afterwards.
+//
+// If an object number occurs more than once, the last occurrence is kept,
+// as objects appended by incremental updates replace earlier ones.
+func (r *PdfReader) scanFile() (*scanIndex, error) {
+	if r.scanned != nil {
+		return r.scanned, nil
+	}
+
+	size, err := r.reader.size()
+	if err != nil {
+		return nil, pdftypes.NewPdfError(pdftypes.IO_ERROR, -1, err)
+	}
+
+	scanned := &scanIndex{make(map[int]pdfobjects.XrefEntry), -1, make(map[pdftypes.PdfName][]int)}
+	buffer := make([]byte, repairWindow+repairOverlap)
+
+	// The object whose header was found last, which a type found
+	// afterwards belongs to.
+	last := -1
+
+	for start := int64(0); start < size; start += repairWindow {
+		n, err := r.reader.readAt(buffer, start)
+		if err != nil && err != io.EOF {
+			return nil, pdftypes.NewPdfError(pdftypes.IO_ERROR, start, err)
+		}
+		data := buffer[:n]
+
+		types := typePattern.FindAllSubmatchIndex(data, -1)
+
+		for _, match := range headerPattern.FindAllSubmatchIndex(data, -1) {
+			// Matches in the overlap are found again in the next window.
+			if match[0] >= repairWindow {
+				break
+			}
+
+			// The header must not be part of a longer token.
+			if match[0] > 0 && isRegular(data[match[0]-1]) {
+				continue
+			}
+			if match[1] < len(data) && isRegular(data[match[1]]) {
+				continue
+			}
+
+			number, err1 := strconv.Atoi(string(data[match[2]:match[3]]))
+			generation, err2 := strconv.Atoi(string(data[match[4]:match[5]]))
+			if err1 != nil || err2 != nil {
+				continue
+			}
+
+			types = scanned.addTypes(data, types, match[0], last)
+			last = number
+
+			scanned.objects[number] = pdfobjects.XrefEntry{
+				Offset: start + int64(match[0]),
+				Generation: generation,
+				InUse: true,
+			}
+		}
+		scanned.addTypes(data, types, repairWindow, last)
+
+		window := data
+		if len(window) > repairWindow {
+			window = window[:repairWindow]
+		}
+		if index := bytes.LastIndex(window, []byte(pdftypes.TRAILER)); index >= 0 {
+			scanned.trailer = start + int64(index)
+		}
+	}
+
+	r.scanned = scanned
+
+	return scanned, nil
+}
+
+// Record the types in `types` found in `data` before `end` as declared by
+// object `number`, and return the types left.
+func (scanned *scanIndex) addTypes(data []byte, types [][]int, end int, number int) [][]int {
+	for len(types) > 0 && types[0][0] < end {
+		match := types[0]
+		types = types[1:]
+
+		// The name must not be part of a longer name.
+		if number < 0 || match[1] < len(data) && isRegular(data[match[1]]) {
+			continue
+		}
+
+		name := pdftypes.PdfName(data[match[2]:match[3]])
+		numbers := scanned.typed[name]
+		if len(numbers) == 0 || numbers[len(numbers)-1] != number {
+			scanned.typed[name] = append(numbers, number)
+		}
+	}
+
+	return types
+}
+
+// Find the objects of type `t`, the last one in the file first.
+//
+// In lazy mode, objects are not kept in memory, so only the objects found
+// to declare the type when scanning the file are loaded. Objects that
+// cannot be loaded are skipped.
+func (r *PdfReader) findObjects(pdf *pdfobjects.Pdf, t pdftypes.PdfName) []*pdfobjects.PdfObject {
+	found := make([]*pdfobjects.PdfObject, 0)
+
+	if !r.lazy {
+		for i := pdf.Count() - 1; i >= 0; i-- {
+			if pobj, err := pdf.ObjectAt(i); err == nil && pobj.GetType() == t {
+				found = append(found, pobj)
+			}
+		}
+		return found
+	}
+
+	scanned, err := r.scanFile()
+	if err != nil {
+		pdf.AddRepair("Skipped search for objects", err)
+		return found
+	}
+
+	numbers := scanned.typed[t]
+	for i := len(numbers) - 1; i >= 0; i-- {
+		entry, ok := pdf.XrefEntry(numbers[i])
+		if !ok || !entry.InUse || entry.Compressed {
+			continue
+		}
+
+		pobj, err := r.loadObject(pdftypes.PdfReference{Object: numbers[i], Generation: entry.Generation})
+		if err != nil {
+			pdf.AddRepair("Skipped unreadable object", err)
+			continue
+		}
+
+		if pobj.GetType() == t {
+			found = append(found, pobj)
+		}
+	}
+
+	return found
+}
+
+// Rebuild the cross-reference table of `pdf` from the object headers found
+// by scanning the file. Entries that were read before are kept.
+func (r *PdfReader) rebuildXref(pdf *pdfobjects.Pdf) error {
+	scanned, err := r.scanFile()
+	if err != nil {
+		return err
+	}
+
+	for number, entry := range scanned.objects {
+		pdf.AddXrefEntry(number, entry)
+	}
+
+	// The trailer is needed before objects are read, e.g. to decrypt them.
+	if dict, err := r.readLastTrailer(); err == nil {
+		mergeTrailer(pdf.Trailer(), dict)
+	}
+
+	return nil
+}
+
+// Look for object `number` elsewhere in the file, after reading it at
+// `offset` failed with `cause`.
+func (r *PdfReader) relocateObject(pdf *pdfobjects.Pdf, number int, offset int64, cause error) (*pdfobjects.PdfObject, error) {
+	scanned, err := r.scanFile()
+	if err != nil {
+		return nil, err
+	}
+
+	entry, ok := scanned.objects[number]
+	if !ok || entry.Offset == offset {
+		return nil, cause
+	}
+
+	obj, err := r.readObjectAt(entry.Offset, number)
+	if err != nil {
+		return nil, err
+	}
+
+	pdf.AddRepair("Corrected offset of object", cause)
+
+	return obj, nil
+}
+
+// Fill in the trailer of `pdf` if it does not reference the document catalog.
+//
+// The keys are taken from the last cross-reference stream, or as a last
+// resort, the catalog is searched for among the objects.
+func (r *PdfReader) recoverTrailer(pdf *pdfobjects.Pdf) {
+	if _, ok := pdf.Root(); ok {
+		return
+	}
+
+	cause := pdftypes.Errorf(pdftypes.XREF_ERROR, -1, "Trailer does not reference the document catalog")
+	trailer := pdf.Trailer()
+
+	for _, pobj := range r.findObjects(pdf, pdftypes.XREFSTREAM) {
+		if trailer[pdftypes.ROOT] != nil {
+			break
+		}
+		mergeTrailer(trailer, pobj.Dict())
+	}
+
+	if trailer[pdftypes.ROOT] == nil {
+		if catalogs := r.findObjects(pdf, pdftypes.CATALOG); len(catalogs) > 0 {
+			trailer[pdftypes.ROOT] = catalogs[0].Reference()
+		}
+	}
+
+	if trailer[pdftypes.SIZE] == nil {
+		size := 0
+		for number := range pdf.Xref() {
+			if number >= size {
+				size = number + 1
+			}
+		}
+		trailer[pdftypes.SIZE] = pdftypes.PdfInteger(size)
+	}
+
+	pdf.SetTrailer(trailer)
+
+	if trailer[pdftypes.ROOT] == nil {
+		pdf.AddRepair("Recovered incomplete trailer", cause)
+	} else {
+		pdf.AddRepair("Recovered trailer", cause)
+	}
+}
+
+// Read the dictionary following the last `trailer` keyword in the file.
+func (r *PdfReader) readLastTrailer() (pdftypes.PdfDict, error) {
+	scanned, err := r.scanFile()
+	if err != nil {
+		return nil, err
+	}
+
+	if scanned.trailer < 0 {
+		return nil, pdftypes.Errorf(pdftypes.XREF_ERROR, -1, "Unable to locate trailer")
+	}
+
+	if err := r.seek(scanned.trailer); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.lexer.next(); err != nil {
+		return nil, err
+	}
+
+	return r.parseDictionaryValue(r.lexer)
+}
+
+// Keys copied from recovered trailer dictionaries.
+var trailerKeys = []pdftypes.PdfName{
+	pdftypes.ROOT,
+	pdftypes.INFO,
+	pdftypes.ID,
+	pdftypes.SIZE,
+	pdftypes.ENCRYPT,
+}
+
+// Copy the trailer keys of `source` that are missing from `dest`.
+func mergeTrailer(dest pdftypes.PdfDict, source pdftypes.PdfDict) {
+	for _, key := range trailerKeys {
+		if _, ok := dest[key]; ok {
+			continue
+		}
+		if value, ok := source[key]; ok {
+			dest[key] = value
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package parser
+
+import (
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdfobjects"
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Resolve `value` while the file is being read. Referenced objects that have
+// not been read yet are loaded from the offsets in the cross-reference table.
+func (r *PdfReader) resolve(value pdftypes.PdfDataType) (pdftypes.PdfDataType, error) {
+	visited := make(map[pdftypes.PdfReference]bool)
+
+	for {
+		ref, ok := value.(pdftypes.PdfReference)
+		if !ok {
+			return value, nil
+		}
+
+		if visited[ref] {
+			return nil, pdftypes.Errorf(pdftypes.REFERENCE_ERROR, -1, "Reference cycle detected at %v.", ref)
+		}
+		visited[ref] = true
+
+		obj, err := r.loadObject(ref)
+		if err != nil {
+			return nil, err
+		}
+
+		value = obj.Value()
+	}
+}
+
+// Replace references in the `/Filter` and `/DecodeParms` entries of the
+// stream dictionary of `pobj`, also within arrays, by the values they refer
+// to, as the filters are read later on without access to the document.
+// References that cannot be resolved are left as they are.
+func (r *PdfReader) resolveFilters(pobj *pdfobjects.PdfObject) {
+	dict := pobj.Dict()
+
+	for _, key := range []pdftypes.PdfName{pdftypes.FILTER, pdftypes.DECODEPARMS} {
+		value, ok := dict[key]
+		if !ok {
+			continue
+		}
+
+		if resolved, err := r.resolve(value); err == nil {
+			value = resolved
+		}
+
+		if array, ok := value.(pdftypes.PdfArray); ok {
+			elements := make(pdftypes.PdfArray, len(array))
+			for i, element := range array {
+				if resolved, err := r.resolve(element); err == nil {
+					element = resolved
+				}
+				elements[i] = element
+			}
+			value = elements
+		}
+
+		dict[key] = value
+	}
+}
+
+// Get the object referenced by `ref`, reading it from the file if needed.
+// The position of the reader is left unchanged.
+func (r *PdfReader) loadObject(ref pdftypes.PdfReference) (*pdfobjects.PdfObject, error) {
+	if r.pdf == nil {
+		return nil, pdftypes.Errorf(pdftypes.REFERENCE_ERROR, -1, "Object %v not found.", ref)
+	}
+
+	// In lazy mode, the `Pdf` would ask the reader to load the object.
+	if !r.lazy {
+		if obj, err := r.pdf.GetObject(ref); err == nil {
+			return obj, nil
+		}
+	}
+
+	entry, ok := r.pdf.XrefEntry(ref.Object)
+	if !ok || !entry.InUse {
+		return nil, pdftypes.Errorf(pdftypes.REFERENCE_ERROR, -1, "Object %v not found.", ref)
+	}
+
+	return r.loadEntry(ref, entry)
+}
+
+// Read the object referenced by `ref` from the location given by `entry`.
+// The position of the reader is left unchanged.
+func (r *PdfReader) loadEntry(ref pdftypes.PdfReference, entry pdfobjects.XrefEntry) (*pdfobjects.PdfObject, error) {
+	// Guard against objects that (indirectly) need themselves to be read.
+	if r.loading[ref] {
+		return nil, pdftypes.Errorf(pdftypes.REFERENCE_ERROR, -1, "Reference cycle detected at %v.", ref)
+	}
+	r.loading[ref] = true
+	defer delete(r.loading, ref)
+
+	if entry.Compressed {
+		objects, err := r.loadObjectStream(entry.Stream)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range objects {
+			if obj.Reference() == ref {
+				return obj, nil
+			}
+		}
+
+		return nil, pdftypes.Errorf(pdftypes.REFERENCE_ERROR, -1, "Object %v not found in object stream.", ref)
+	}
+
+	// Remember where we are, including any tokens read ahead.
+	offset := r.lexer.offset
+	buffer := append([]token(nil), r.lexer.buffer...)
+
+	if err := r.seek(entry.Offset); err != nil {
+		return nil, err
+	}
+
+	obj, err := r.readObject()
+
+	if err := r.seek(offset); err != nil {
+		return nil, err
+	}
+	r.lexer.buffer = append(r.lexer.buffer, buffer...)
+
+	return obj, err
+}
+
+// The objects of the most recently loaded object stream.
+type objectStreamCache struct {
+	number int
+	objects []*pdfobjects.PdfObject
+}
+
+// Get the objects stored in the object stream with number `number`.
+// The last stream loaded is kept, as objects sharing a stream are
+// often loaded one after another.
+func (r *PdfReader) loadObjectStream(number int) ([]*pdfobjects.PdfObject, error) {
+	if r.objectStream != nil && r.objectStream.number == number {
+		return r.objectStream.objects, nil
+	}
+
+	stream, err := r.loadObject(pdftypes.PdfReference{Object: number})
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := r.readObjectStream(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	r.objectStream = &objectStreamCache{number, objects}
+
+	return objects, nil
+}
@@ -0,0 +1,268 @@
+package parser
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdfobjects"
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Number of bytes at the end of the file to search for `startxref`.
+const startxrefWindow = 1024
+
+// Locate the offset of the last cross-reference section from the
+// `startxref` keyword near the end of the file.
+func (r *PdfReader) findStartxref() (int64, error) {
+	size, err := r.reader.size()
+	if err != nil {
+		return 0, pdftypes.NewPdfError(pdftypes.IO_ERROR, -1, err)
+	}
+
+	window := int64(startxrefWindow)
+	if size < window {
+		window = size
+	}
+
+	buffer := make([]byte, window)
+	if _, err := r.reader.readAt(buffer, size-window); err != nil {
+		return 0, pdftypes.NewPdfError(pdftypes.IO_ERROR, size-window, err)
+	}
+
+	index := bytes.LastIndex(buffer, []byte(pdftypes.STARTXREF))
+	if index < 0 {
+		return 0, pdftypes.Errorf(pdftypes.XREF_ERROR, -1, "Unable to locate startxref")
+	}
+
+	fields := strings.Fields(string(buffer[index+len(pdftypes.STARTXREF):]))
+	if len(fields) == 0 {
+		return 0, pdftypes.Errorf(pdftypes.XREF_ERROR, size-window+int64(index), "Missing offset after startxref")
+	}
+
+	offset, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, pdftypes.NewPdfError(pdftypes.XREF_ERROR, size-window+int64(index), err)
+	}
+
+	return offset, nil
+}
+
+// Read the cross-reference table and trailer into `pdf`.
+//
+// Older sections referenced with `/Prev` are read as well. Entries from newer
+// sections take precedence over older ones.
+func (r *PdfReader) readXref(pdf *pdfobjects.Pdf) error {
+	offset, err := r.findStartxref()
+	if err != nil {
+		return err
+	}
+
+	visited := make(map[int64]bool)
+
+	for !visited[offset] {
+		visited[offset] = true
+
+		entries, trailer, err := r.readXrefSection(offset)
+		if err != nil {
+			return err
+		}
+
+		for number, entry := range entries {
+			pdf.AddXrefEntry(number, entry)
+		}
+		pdf.AddRevision(entries, trailer)
+
+		// The trailer of the newest section describes the document.
+		if len(visited) == 1 {
+			pdf.SetTrailer(trailer)
+		}
+
+		prev, ok := pdftypes.IntValue(trailer[pdftypes.PREV])
+		if !ok {
+			break
+		}
+		offset = prev
+	}
+
+	return nil
+}
+
+// Read the cross-reference section at `offset`, which is either a classic
+// table or a cross-reference stream, and return its entries and trailer.
+func (r *PdfReader) readXrefSection(offset int64) (map[int]pdfobjects.XrefEntry, pdftypes.PdfDict, error) {
+	if err := r.seek(offset); err != nil {
+		return nil, nil, err
+	}
+
+	t, err := r.lexer.peek(0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !t.is(pdftypes.XREF) {
+		// Not a table, so this should be a cross-reference stream object.
+		return r.readXrefStream()
+	}
+
+	r.lexer.next()
+	entries, trailer, err := r.readXrefTable()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Hybrid files keep objects stored in object streams in a separate
+	// cross-reference stream, which fills the gaps in the table.
+	if stm, ok := pdftypes.IntValue(trailer[pdftypes.XREFSTM]); ok {
+		if err := r.seek(stm); err != nil {
+			return nil, nil, err
+		}
+
+		hidden, _, err := r.readXrefStream()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for number, entry := range hidden {
+			if current, ok := entries[number]; !ok || !current.InUse {
+				entries[number] = entry
+			}
+		}
+	}
+
+	return entries, trailer, nil
+}
+
+// Read a classic cross-reference table and the trailer dictionary following
+// it. The lexer must be positioned right after the xref keyword.
+func (r *PdfReader) readXrefTable() (map[int]pdfobjects.XrefEntry, pdftypes.PdfDict, error) {
+	entries := make(map[int]pdfobjects.XrefEntry)
+
+	for {
+		t, err := r.lexer.next()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if t.is(pdftypes.TRAILER) {
+			trailer, err := r.parseDictionaryValue(r.lexer)
+			return entries, trailer, err
+		}
+
+		// Subsection header: first object number and number of entries.
+		first, err := parseInteger(t)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		count, err := r.nextInteger()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for i := 0; i < count; i++ {
+			// Each entry consists of an offset, a generation and a type.
+			entry_offset, err := r.nextInteger()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			generation, err := r.nextInteger()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			kind, err := r.lexer.next()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if !kind.is("n") && !kind.is("f") {
+				return nil, nil, unexpectedToken("n or f", kind)
+			}
+
+			if err := r.countEntry(); err != nil {
+				return nil, nil, err
+			}
+
+			entries[first+i] = pdfobjects.XrefEntry{
+				Offset: int64(entry_offset),
+				Generation: generation,
+				InUse: kind.is("n"),
+			}
+		}
+	}
+}
+
+// Read the next token and parse it as an integer.
+func (r *PdfReader) nextInteger() (int, error) {
+	t, err := r.lexer.next()
+	if err != nil {
+		return 0, err
+	}
+	return parseInteger(t)
+}
+
+// Parse a value that must be a dictionary, such as the trailer.
+func (r *PdfReader) parseDictionaryValue(l *lexer) (pdftypes.PdfDict, error) {
+	t, err := l.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if t.kind != tokenDictBegin {
+		return nil, unexpectedToken(pdftypes.DICT_BEGIN, t)
+	}
+
+	return r.parseDictionary(l)
+}
+
+// Get the numbers of objects in use that are stored directly in the file,
+// sorted by their offset.
+func objectNumbers(pdf *pdfobjects.Pdf) []int {
+	return sortedNumbers(pdf.Xref())
+}
+
+// Count the objects in use in the cross-reference table of `pdf`,
+// including those stored in object streams.
+func countInUse(pdf *pdfobjects.Pdf) int {
+	count := 0
+	for _, entry := range pdf.Xref() {
+		if entry.InUse {
+			count++
+		}
+	}
+	return count
+}
+
+// Get the numbers of the entries in `xref` of objects in use that are stored
+// directly in the file, sorted by their offset.
+func sortedNumbers(xref map[int]pdfobjects.XrefEntry) []int {
+	numbers := make([]int, 0, len(xref))
+
+	for number, entry := range xref {
+		if entry.InUse && !entry.Compressed {
+			numbers = append(numbers, number)
+		}
+	}
+
+	sort.Slice(numbers, func(i, j int) bool {
+		return xref[numbers[i]].Offset < xref[numbers[j]].Offset
+	})
+
+	return numbers
+}
+
+// Get the oldest revision of `pdf` whose cross-reference section records
+// object `number` at the location of `entry`.
+func introducedIn(pdf *pdfobjects.Pdf, number int, entry pdfobjects.XrefEntry) int {
+	for i := 0; i < pdf.RevisionCount(); i++ {
+		rev, _ := pdf.Revision(i)
+		if update, ok := rev.Updates()[number]; ok && update.InUse && update.SameLocation(entry) {
+			return i
+		}
+	}
+
+	return pdf.RevisionCount() - 1
+}
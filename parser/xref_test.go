@@ -0,0 +1,155 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdfobjects"
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Read only the cross-reference sections of `data`.
+func readXrefOnly(t *testing.T, data []byte) (*pdfobjects.Pdf, error) {
+	t.Helper()
+
+	reader, err := NewPdfReaderFromBytes("test.pdf", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	pdf := pdfobjects.NewPdf("test.pdf")
+	return pdf, reader.readXref(pdf)
+}
+
+func TestReadXrefTable(t *testing.T) {
+	data := buildPdf("<< /Type /Catalog >>", "42")
+
+	pdf, err := readXrefOnly(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entry, ok := pdf.XrefEntry(0); !ok || entry.InUse || entry.Generation != 65535 {
+		t.Errorf("Object 0: got %+v, %v", entry, ok)
+	}
+	for number := 1; number <= 2; number++ {
+		expected := int64(bytes.Index(data, []byte(fmt.Sprintf("%d 0 obj", number))))
+		if entry, ok := pdf.XrefEntry(number); !ok || !entry.InUse || entry.Offset != expected {
+			t.Errorf("Object %d: got %+v, %v, expected offset %d", number, entry, ok, expected)
+		}
+	}
+	if _, ok := pdf.XrefEntry(3); ok {
+		t.Errorf("Entry for object 3 not in the table")
+	}
+
+	if root, ok := pdf.Root(); !ok || root.Object != 1 {
+		t.Errorf("Root: got %v, %v", root, ok)
+	}
+	if size, ok := pdftypes.IntValue(pdf.Trailer()[pdftypes.NewPdfName("/Size")]); !ok || size != 3 {
+		t.Errorf("Size: got %v, %v", size, ok)
+	}
+}
+
+// Tables can have several subsections, free entries and two-byte end-of-line
+// markers, and the offset after startxref can be followed by white-space.
+func TestReadXrefSubsections(t *testing.T) {
+	data := "%PDF-1.4\n" +
+		"xref\r\n" +
+		"0 2\r\n" +
+		"0000000003 65535 f\r\n" +
+		"0000000100 00000 n\r\n" +
+		"3 2\n" +
+		"0000000000 00001 f \n" +
+		"0000000200 00002 n \n" +
+		"trailer << /Size 5 /Root 1 0 R >>\n" +
+		"startxref\n9 \n%%EOF\n"
+
+	pdf, err := readXrefOnly(t, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[int]pdfobjects.XrefEntry{
+		0: {Offset: 3, Generation: 65535},
+		1: {Offset: 100, InUse: true},
+		3: {Offset: 0, Generation: 1},
+		4: {Offset: 200, Generation: 2, InUse: true},
+	}
+	for number, entry := range expected {
+		if actual, ok := pdf.XrefEntry(number); !ok || actual != entry {
+			t.Errorf("Object %d: got %+v, %v, expected %+v", number, actual, ok, entry)
+		}
+	}
+	if _, ok := pdf.XrefEntry(2); ok {
+		t.Errorf("Entry for object 2 not in the table")
+	}
+}
+
+// Sections are followed through /Prev, and newer entries win.
+func TestReadXrefPrev(t *testing.T) {
+	original := buildPdf("<< /Type /Catalog >>", "1", "2")
+	data := appendUpdate(original, map[int]string{2: "3"})
+
+	pdf, err := readXrefOnly(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated := int64(bytes.LastIndex(data, []byte("2 0 obj")))
+	if entry, _ := pdf.XrefEntry(2); entry.Offset != updated {
+		t.Errorf("Object 2: got offset %d, expected %d", entry.Offset, updated)
+	}
+	if entry, ok := pdf.XrefEntry(3); !ok || !entry.InUse {
+		t.Errorf("Object 3 from the older section missing: %+v", entry)
+	}
+	if _, ok := pdf.Trailer()[pdftypes.PREV]; !ok {
+		t.Errorf("Trailer of the newest section not used: %v", pdf.Trailer())
+	}
+	if count := pdf.RevisionCount(); count != 2 {
+		t.Errorf("Got %d revisions, expected 2", count)
+	}
+}
+
+// A section that is its own /Prev is only read once.
+func TestReadXrefPrevLoop(t *testing.T) {
+	data := buildPdf("<< /Type /Catalog >>")
+	xref := bytes.Index(data, []byte("\nxref\n")) + 1
+	data = bytes.Replace(data, []byte("/Root 1 0 R"), []byte(fmt.Sprintf("/Root 1 0 R /Prev %d", xref)), 1)
+
+	pdf, err := readXrefOnly(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := pdf.RevisionCount(); count != 1 {
+		t.Errorf("Got %d revisions, expected 1", count)
+	}
+}
+
+func TestReadXrefErrors(t *testing.T) {
+	valid := string(buildPdf("<< /Type /Catalog >>"))
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"missing startxref", strings.Replace(valid, "startxref", "", 1)},
+		{"missing offset", valid[:strings.LastIndex(valid, "startxref")+len("startxref")]},
+		{"invalid offset", strings.Replace(valid, "startxref\n", "startxref\nabc", 1)},
+		{"invalid entry type", strings.Replace(valid, "00000 n", "00000 x", 1)},
+		{"missing entry", strings.Replace(valid, "0 2\n", "0 3\n", 1)},
+		{"missing trailer", strings.Replace(valid, "trailer", "", 1)},
+	}
+
+	for _, test := range tests {
+		_, err := readXrefOnly(t, []byte(test.data))
+
+		var pdf_err *pdftypes.PdfError
+		if err == nil || !errors.As(err, &pdf_err) {
+			t.Errorf("%s: expected a pdf error, got %v", test.name, err)
+		}
+	}
+}
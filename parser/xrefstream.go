@@ -0,0 +1,143 @@
+package parser
+
+import (
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdfobjects"
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Read a cross-reference stream object at the current position of the
+// reader and return its entries. The stream dictionary doubles as trailer.
+func (r *PdfReader) readXrefStream() (map[int]pdfobjects.XrefEntry, pdftypes.PdfDict, error) {
+	pobj, err := r.readObject()
+	if err != nil {
+		return nil, nil, err
+	}
+	dict := pobj.Dict()
+
+	if pobj.GetType() != pdftypes.XREFSTREAM {
+		return nil, nil, pdftypes.Errorf(pdftypes.XREF_ERROR, -1, "Expected object of type %s, got %s", pdftypes.XREFSTREAM, pobj.GetType())
+	}
+
+	widths, err := xrefWidths(dict)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := pobj.DecodeStream()
+	if err != nil {
+		return nil, nil, pdftypes.WithReference(err, pdftypes.DECODE_ERROR, pobj.Reference())
+	}
+
+	entries := make(map[int]pdfobjects.XrefEntry)
+	row := widths[0] + widths[1] + widths[2]
+	if row == 0 {
+		return nil, nil, pdftypes.Errorf(pdftypes.XREF_ERROR, -1, "Cross-reference stream has empty /W")
+	}
+
+	index, err := xrefIndex(dict)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := 0; i+1 < len(index); i += 2 {
+		first, count := index[i], index[i+1]
+
+		for j := 0; j < count; j++ {
+			if len(data) < row {
+				return nil, nil, pdftypes.Errorf(pdftypes.XREF_ERROR, -1, "Cross-reference stream is truncated")
+			}
+
+			fields := [3]int64{}
+			rest := data[:row]
+			for k, width := range widths {
+				fields[k] = readField(rest[:width])
+				rest = rest[width:]
+			}
+			data = data[row:]
+
+			if err := r.countEntry(); err != nil {
+				return nil, nil, err
+			}
+
+			// The type field defaults to 1 if it is omitted.
+			if widths[0] == 0 {
+				fields[0] = 1
+			}
+
+			switch fields[0] {
+			case 0:
+				entries[first+j] = pdfobjects.XrefEntry{
+					Generation: int(fields[2]),
+				}
+			case 1:
+				entries[first+j] = pdfobjects.XrefEntry{
+					Offset: fields[1],
+					Generation: int(fields[2]),
+					InUse: true,
+				}
+			case 2:
+				entries[first+j] = pdfobjects.XrefEntry{
+					InUse: true,
+					Compressed: true,
+					Stream: int(fields[1]),
+					Index: int(fields[2]),
+				}
+			}
+		}
+	}
+
+	return entries, dict, nil
+}
+
+// Get the field widths (`/W`) of a cross-reference stream.
+func xrefWidths(dict pdftypes.PdfDict) ([3]int, error) {
+	widths := [3]int{}
+
+	array, ok := dict[pdftypes.W].(pdftypes.PdfArray)
+	if !ok || len(array) != 3 {
+		return widths, pdftypes.Errorf(pdftypes.XREF_ERROR, -1, "Cross-reference stream has invalid /W")
+	}
+
+	for i, value := range array {
+		width, ok := pdftypes.IntValue(value)
+		if !ok || width < 0 || width > 8 {
+			return widths, pdftypes.Errorf(pdftypes.XREF_ERROR, -1, "Cross-reference stream has invalid /W")
+		}
+		widths[i] = int(width)
+	}
+
+	return widths, nil
+}
+
+// Get the subsections (`/Index`) of a cross-reference stream as pairs of
+// first object number and number of entries. Defaults to `[0 /Size]`.
+func xrefIndex(dict pdftypes.PdfDict) ([]int, error) {
+	array, ok := dict[pdftypes.INDEX].(pdftypes.PdfArray)
+	if !ok {
+		size, ok := pdftypes.IntValue(dict[pdftypes.SIZE])
+		if !ok {
+			return nil, pdftypes.Errorf(pdftypes.XREF_ERROR, -1, "Cross-reference stream has no /Size")
+		}
+		return []int{0, int(size)}, nil
+	}
+
+	index := make([]int, len(array))
+	for i, value := range array {
+		number, ok := pdftypes.IntValue(value)
+		if !ok {
+			return nil, pdftypes.Errorf(pdftypes.XREF_ERROR, -1, "Cross-reference stream has invalid /Index")
+		}
+		index[i] = int(number)
+	}
+
+	return index, nil
+}
+
+// Read a big-endian unsigned integer.
+func readField(field []byte) int64 {
+	var value int64
+	for _, b := range field {
+		value = value<<8 | int64(b)
+	}
+	return value
+}
@@ -0,0 +1,563 @@
+package pdfobjects
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// A bilevel image with one bit per pixel and rows padded to whole bytes.
+// Set bits are black if `BlackIs1` is true, and white otherwise, following
+// the `/BlackIs1` parameter of `/CCITTFaxDecode`.
+type Bitmap struct {
+	Width int
+	Height int
+	Data []byte
+	BlackIs1 bool
+}
+
+// Number of bytes in a row of the bitmap.
+func (b Bitmap) Stride() int {
+	return (b.Width + 7) / 8
+}
+
+// Check whether the pixel at `x`, `y` is black.
+func (b Bitmap) IsBlack(x, y int) bool {
+	bit := b.Data[y*b.Stride()+x/8]>>(7-x%8)&1 == 1
+	return bit == b.BlackIs1
+}
+
+// Convert the bitmap to a grayscale image, e.g. to pass it on to OCR.
+func (b Bitmap) Image() *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, b.Width, b.Height))
+
+	for y := 0; y < b.Height; y++ {
+		for x := 0; x < b.Width; x++ {
+			if b.IsBlack(x, y) {
+				img.SetGray(x, y, color.Gray{0})
+			} else {
+				img.SetGray(x, y, color.Gray{255})
+			}
+		}
+	}
+
+	return img
+}
+
+// A Huffman code of `length` bits.
+type faxCode struct {
+	length int
+	bits uint32
+}
+
+// Build a lookup table from codes written as strings of '0' and '1'.
+func faxTable(codes map[string]int) map[faxCode]int {
+	table := make(map[faxCode]int, len(codes))
+	for str, value := range codes {
+		var bits uint32
+		for _, c := range str {
+			bits = bits<<1 | uint32(c-'0')
+		}
+		table[faxCode{len(str), bits}] = value
+	}
+	return table
+}
+
+// Makeup codes for runs from 1792 to 2560, shared by both colours.
+var faxExtendedMakeup = map[string]int{
+	"00000001000": 1792, "00000001100": 1856, "00000001101": 1920,
+	"000000010010": 1984, "000000010011": 2048, "000000010100": 2112,
+	"000000010101": 2176, "000000010110": 2240, "000000010111": 2304,
+	"000000011100": 2368, "000000011101": 2432, "000000011110": 2496,
+	"000000011111": 2560,
+}
+
+// Run length codes for white runs, terminating codes and makeup codes.
+var faxWhiteCodes = map[string]int{
+	"00110101": 0, "000111": 1, "0111": 2, "1000": 3, "1011": 4, "1100": 5,
+	"1110": 6, "1111": 7, "10011": 8, "10100": 9, "00111": 10, "01000": 11,
+	"001000": 12, "000011": 13, "110100": 14, "110101": 15, "101010": 16,
+	"101011": 17, "0100111": 18, "0001100": 19, "0001000": 20, "0010111": 21,
+	"0000011": 22, "0000100": 23, "0101000": 24, "0101011": 25, "0010011": 26,
+	"0100100": 27, "0011000": 28, "00000010": 29, "00000011": 30,
+	"00011010": 31, "00011011": 32, "00010010": 33, "00010011": 34,
+	"00010100": 35, "00010101": 36, "00010110": 37, "00010111": 38,
+	"00101000": 39, "00101001": 40, "00101010": 41, "00101011": 42,
+	"00101100": 43, "00101101": 44, "00000100": 45, "00000101": 46,
+	"00001010": 47, "00001011": 48, "01010010": 49, "01010011": 50,
+	"01010100": 51, "01010101": 52, "00100100": 53, "00100101": 54,
+	"01011000": 55, "01011001": 56, "01011010": 57, "01011011": 58,
+	"01001010": 59, "01001011": 60, "00110010": 61, "00110011": 62,
+	"00110100": 63,
+
+	"11011": 64, "10010": 128, "010111": 192, "0110111": 256,
+	"00110110": 320, "00110111": 384, "01100100": 448, "01100101": 512,
+	"01101000": 576, "01100111": 640, "011001100": 704, "011001101": 768,
+	"011010010": 832, "011010011": 896, "011010100": 960, "011010101": 1024,
+	"011010110": 1088, "011010111": 1152, "011011000": 1216,
+	"011011001": 1280, "011011010": 1344, "011011011": 1408,
+	"010011000": 1472, "010011001": 1536, "010011010": 1600, "011000": 1664,
+	"010011011": 1728,
+}
+
+// Run length codes for black runs, terminating codes and makeup codes.
+var faxBlackCodes = map[string]int{
+	"0000110111": 0, "010": 1, "11": 2, "10": 3, "011": 4, "0011": 5,
+	"0010": 6, "00011": 7, "000101": 8, "000100": 9, "0000100": 10,
+	"0000101": 11, "0000111": 12, "00000100": 13, "00000111": 14,
+	"000011000": 15, "0000010111": 16, "0000011000": 17, "0000001000": 18,
+	"00001100111": 19, "00001101000": 20, "00001101100": 21,
+	"00000110111": 22, "00000101000": 23, "00000010111": 24,
+	"00000011000": 25, "000011001010": 26, "000011001011": 27,
+	"000011001100": 28, "000011001101": 29, "000001101000": 30,
+	"000001101001": 31, "000001101010": 32, "000001101011": 33,
+	"000011010010": 34, "000011010011": 35, "000011010100": 36,
+	"000011010101": 37, "000011010110": 38, "000011010111": 39,
+	"000001101100": 40, "000001101101": 41, "000011011010": 42,
+	"000011011011": 43, "000001010100": 44, "000001010101": 45,
+	"000001010110": 46, "000001010111": 47, "000001100100": 48,
+	"000001100101": 49, "000001010010": 50, "000001010011": 51,
+	"000000100100": 52, "000000110111": 53, "000000111000": 54,
+	"000000100111": 55, "000000101000": 56, "000001011000": 57,
+	"000001011001": 58, "000000101011": 59, "000000101100": 60,
+	"000001011010": 61, "000001100110": 62, "000001100111": 63,
+
+	"0000001111": 64, "000011001000": 128, "000011001001": 192,
+	"000001011011": 256, "000000110011": 320, "000000110100": 384,
+	"000000110101": 448, "0000001101100": 512, "0000001101101": 576,
+	"0000001001010": 640, "0000001001011": 704, "0000001001100": 768,
+	"0000001001101": 832, "0000001110010": 896, "0000001110011": 960,
+	"0000001110100": 1024, "0000001110101": 1088, "0000001110110": 1152,
+	"0000001110111": 1216, "0000001010010": 1280, "0000001010011": 1344,
+	"0000001010100": 1408, "0000001010101": 1472, "0000001011010": 1536,
+	"0000001011011": 1600, "0000001100100": 1664, "0000001100101": 1728,
+}
+
+// Coding modes of two-dimensional coding.
+const (
+	FAX_PASS = iota
+	FAX_HORIZONTAL
+	FAX_VERTICAL
+)
+
+// Mode codes of two-dimensional coding. The mode is stored in the high bits,
+// and for vertical modes the offset of a1 from b1 plus 3 in the low bits.
+var faxModeCodes = map[string]int{
+	"0001": FAX_PASS<<3,
+	"001": FAX_HORIZONTAL<<3,
+	"1": FAX_VERTICAL<<3 | 3,
+	"011": FAX_VERTICAL<<3 | 4,
+	"000011": FAX_VERTICAL<<3 | 5,
+	"0000011": FAX_VERTICAL<<3 | 6,
+	"010": FAX_VERTICAL<<3 | 2,
+	"000010": FAX_VERTICAL<<3 | 1,
+	"0000010": FAX_VERTICAL<<3 | 0,
+}
+
+var (
+	faxWhite = faxTable(faxWhiteCodes)
+	faxBlack = faxTable(faxBlackCodes)
+	faxExtended = faxTable(faxExtendedMakeup)
+	faxModes = faxTable(faxModeCodes)
+)
+
+// Number of zero bits an end-of-line code (EOL) starts with.
+const FAX_EOL_ZEROS = 11
+
+// Reads CCITT encoded data bit by bit, most significant bit first.
+type faxReader struct {
+	data []byte
+	pos int
+}
+
+// Check whether all bits have been read.
+func (r *faxReader) done() bool {
+	return r.pos >= len(r.data)*8
+}
+
+// Read the next bit. Bits past the end of the data read as 0.
+func (r *faxReader) bit() uint32 {
+	if r.done() {
+		r.pos++
+		return 0
+	}
+	b := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+	r.pos++
+	return uint32(b)
+}
+
+// Skip to the next byte boundary.
+func (r *faxReader) align() {
+	r.pos = (r.pos + 7) / 8 * 8
+}
+
+// Read a code from one of `tables`, trying codes of up to 13 bits.
+func (r *faxReader) code(tables ...map[faxCode]int) (int, bool) {
+	var bits uint32
+	for length := 1; length <= 13 && !r.done(); length++ {
+		bits = bits<<1 | r.bit()
+		for _, table := range tables {
+			if value, ok := table[faxCode{length, bits}]; ok {
+				return value, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Skip an EOL code and any fill bits before it. The reader is left
+// unchanged if the next bits are not an EOL.
+func (r *faxReader) eol() bool {
+	start, zeros := r.pos, 0
+	for !r.done() {
+		if r.bit() == 1 {
+			if zeros >= FAX_EOL_ZEROS {
+				return true
+			}
+			break
+		}
+		zeros++
+	}
+
+	r.pos = start
+	return false
+}
+
+// Read a run length of the colour `black`, adding up makeup codes.
+func (r *faxReader) run(black bool) (int, error) {
+	table := faxWhite
+	if black {
+		table = faxBlack
+	}
+
+	total := 0
+	for {
+		length, ok := r.code(table, faxExtended)
+		if !ok {
+			return 0, pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "Invalid CCITT run length code at bit %d", r.pos)
+		}
+
+		total += length
+		if length < 64 {
+			return total, nil
+		}
+	}
+}
+
+// Largest `/Columns` and `/Rows` accepted, far above any real fax or scan.
+const (
+	FAX_MAX_COLUMNS = 1 << 16
+	FAX_MAX_ROWS = 1 << 16
+)
+
+// Parameters of `/CCITTFaxDecode`.
+type faxParms struct {
+	k int
+	columns int
+	rows int
+	black_is_1 bool
+	byte_align bool
+}
+
+// Read the parameters from `parms`, using the default values for missing entries.
+func readFaxParms(parms pdftypes.PdfDict) (faxParms, error) {
+	invalid := false
+	getInt := func(key pdftypes.PdfName, fallback int, max int64) int {
+		value, err := parms.GetInt(key, nil)
+		if err != nil {
+			return fallback
+		}
+		if value < -max || value > max {
+			invalid = true
+			return fallback
+		}
+		return int(value)
+	}
+	getBool := func(key pdftypes.PdfName) bool {
+		value, _ := parms.Get(key)
+		return value == pdftypes.PdfBool(true)
+	}
+
+	p := faxParms{
+		getInt(pdftypes.K, 0, math.MaxInt32),
+		getInt(pdftypes.COLUMNS, 1728, FAX_MAX_COLUMNS),
+		getInt(pdftypes.ROWS, 0, FAX_MAX_ROWS),
+		getBool(pdftypes.BLACKIS1),
+		getBool(pdftypes.ENCODEDBYTEALIGN),
+	}
+
+	// A missing `/Rows` means the rows are counted while decoding.
+	_, has_rows := parms.Get(pdftypes.ROWS)
+	if invalid || p.columns < 1 || p.rows < 0 || has_rows && p.rows == 0 {
+		return p, pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "Invalid /Columns or /Rows")
+	}
+
+	return p, nil
+}
+
+// Decode CCITT Group 3 or Group 4 fax data as specified for `/CCITTFaxDecode`.
+//
+// `/K` selects the coding: negative for Group 4, 0 for one-dimensional Group 3
+// and positive for mixed one- and two-dimensional Group 3. Decoding stops
+// after `/Rows` rows, at the end-of-block code or at the end of the data.
+// Once a row has been decoded, damaged data ends the image instead of
+// failing; missing rows are left white.
+func DecodeCCITTFax(data []byte, parms pdftypes.PdfDict) (Bitmap, error) {
+	return decodeCCITTFax(data, parms, 0)
+}
+
+// Decode fax encoded data into a bitmap of at most `limit` bytes,
+// unless it is 0.
+func decodeCCITTFax(data []byte, parms pdftypes.PdfDict, limit int64) (Bitmap, error) {
+	p, err := readFaxParms(parms)
+	if err != nil {
+		return Bitmap{}, err
+	}
+
+	r := &faxReader{data, 0}
+
+	// Changing elements of the reference line, where the colour changes
+	// from white to black at even and from black to white at odd indices.
+	// The line above the first row is white.
+	reference := []int{p.columns, p.columns}
+	rows := make([][]int, 0)
+
+	for p.rows == 0 && len(rows) < FAX_MAX_ROWS || len(rows) < p.rows {
+		// Rows are aligned to bytes after the EOL preceding them, if any.
+		if p.byte_align && p.k < 0 {
+			r.align()
+		}
+
+		if r.eol() {
+			// Group 4 data ends with two EOLs and Group 3 data with six.
+			if p.k < 0 || r.eol() {
+				break
+			}
+		}
+
+		if p.byte_align && p.k >= 0 {
+			r.align()
+		}
+
+		if r.done() {
+			break
+		}
+
+		two_dimensional := p.k < 0
+		if p.k > 0 {
+			two_dimensional = r.bit() == 0
+		}
+
+		var changes []int
+		if two_dimensional {
+			changes, err = decodeFaxRow2D(r, reference, p.columns)
+		} else {
+			changes, err = decodeFaxRow1D(r, p.columns)
+		}
+
+		if err == nil && r.pos > len(r.data)*8 {
+			err = pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "CCITT data is truncated")
+		}
+
+		if err != nil {
+			if len(rows) == 0 {
+				return Bitmap{}, err
+			}
+			break
+		}
+
+		rows = append(rows, changes)
+		reference = append(changes, p.columns, p.columns)
+
+		if err := checkFaxSize(p.columns, len(rows), limit); err != nil {
+			return Bitmap{}, err
+		}
+	}
+
+	height := len(rows)
+	if p.rows > 0 {
+		height = p.rows
+	}
+
+	if err := checkFaxSize(p.columns, height, limit); err != nil {
+		return Bitmap{}, err
+	}
+
+	return renderFaxRows(rows, p.columns, height, p.black_is_1), nil
+}
+
+// Check that a bitmap of `columns` by `rows` pixels fits in memory and in
+// `limit` bytes, unless it is 0.
+func checkFaxSize(columns int, rows int, limit int64) error {
+	stride := (int64(columns) + 7) / 8
+	if columns < 1 || rows < 0 || int64(rows) > math.MaxInt32/stride {
+		return pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "Fax image of %d by %d pixels is too large", columns, rows)
+	}
+	return checkStreamSize(int(stride*int64(rows)), limit)
+}
+
+// Decode the stream of a fax encoded image, i.e. one whose last filter is
+// `/CCITTFaxDecode`, into a bitmap. The height of the image (`/Height`) is
+// used if the filter parameters do not give the number of rows.
+func (pobj PdfObject) DecodeBitmap() (Bitmap, error) {
+	filters, err := pobj.Filters()
+	if err != nil {
+		return Bitmap{}, pdftypes.WithReference(err, pdftypes.DECODE_ERROR, pobj.pos)
+	}
+
+	if len(filters) == 0 || filters[len(filters)-1].Name != pdftypes.CCITTFAXDECODE {
+		return Bitmap{}, pdftypes.WithReference(
+			pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "Stream is not fax encoded."),
+			pdftypes.DECODE_ERROR,
+			pobj.pos,
+		)
+	}
+
+	last := filters[len(filters)-1]
+	data, err := pobj.Stream.Decode(filters[:len(filters)-1])
+	if err != nil {
+		return Bitmap{}, pdftypes.WithReference(err, pdftypes.DECODE_ERROR, pobj.pos)
+	}
+
+	parms := make(pdftypes.PdfDict, len(last.Parms)+1)
+	for key, value := range last.Parms {
+		parms[key] = value
+	}
+	if _, ok := parms.Get(pdftypes.ROWS); !ok {
+		if height, ok := pobj.dict.Get(pdftypes.HEIGHT); ok {
+			parms[pdftypes.ROWS] = height
+		}
+	}
+
+	bitmap, err := decodeCCITTFax(data, parms, last.Limit)
+	if err == nil {
+		err = pobj.limiter.AddDecoded(len(bitmap.Data))
+	}
+	if err != nil {
+		return Bitmap{}, pdftypes.WithReference(err, pdftypes.DECODE_ERROR, pobj.pos)
+	}
+
+	return bitmap, nil
+}
+
+// Decode a one-dimensionally coded row into its changing elements.
+func decodeFaxRow1D(r *faxReader, columns int) ([]int, error) {
+	changes := make([]int, 0)
+	position, black := 0, false
+
+	for position < columns {
+		run, err := r.run(black)
+		if err != nil {
+			return nil, err
+		}
+
+		position += run
+		changes = append(changes, position)
+		black = !black
+	}
+
+	return clipChanges(changes, columns), nil
+}
+
+// Decode a two-dimensionally coded row into its changing elements,
+// relative to the changing elements of the row above, `reference`.
+func decodeFaxRow2D(r *faxReader, reference []int, columns int) ([]int, error) {
+	changes := make([]int, 0)
+	a0, black := -1, false
+
+	for a0 < columns {
+		// b1 is the first change on the reference line to the right of a0
+		// to the opposite colour of a0, and b2 the change after it.
+		i := 0
+		for i < len(reference)-2 && (reference[i] <= a0 || (i%2 == 1) != black) {
+			i++
+		}
+		b1, b2 := reference[i], reference[i+1]
+
+		mode, ok := r.code(faxModes)
+		if !ok {
+			return nil, pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "Invalid CCITT mode code at bit %d", r.pos)
+		}
+
+		switch mode >> 3 {
+		case FAX_PASS:
+			a0 = b2
+
+		case FAX_HORIZONTAL:
+			if a0 < 0 {
+				a0 = 0
+			}
+
+			run1, err := r.run(black)
+			if err != nil {
+				return nil, err
+			}
+			run2, err := r.run(!black)
+			if err != nil {
+				return nil, err
+			}
+
+			changes = append(changes, a0+run1, a0+run1+run2)
+			a0 += run1 + run2
+
+		case FAX_VERTICAL:
+			a1 := b1 + mode&7 - 3
+			if a1 < 0 || a1 < a0 {
+				return nil, pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "Invalid CCITT vertical mode at bit %d", r.pos)
+			}
+
+			changes = append(changes, a1)
+			a0, black = a1, !black
+		}
+	}
+
+	return clipChanges(changes, columns), nil
+}
+
+// Limit changing elements to the width of the row. Elements are kept in
+// pairs, so that even and odd indices keep their meaning.
+func clipChanges(changes []int, columns int) []int {
+	for i, position := range changes {
+		if position >= columns {
+			return changes[:i]
+		}
+	}
+	return changes
+}
+
+// Render rows of changing elements as a bitmap. Rows not given are white.
+func renderFaxRows(rows [][]int, columns int, height int, black_is_1 bool) Bitmap {
+	bitmap := Bitmap{columns, height, nil, black_is_1}
+	stride := bitmap.Stride()
+	bitmap.Data = make([]byte, stride*height)
+
+	// Set bits are white unless `black_is_1` is set.
+	if !black_is_1 {
+		for i := range bitmap.Data {
+			bitmap.Data[i] = 0xFF
+		}
+	}
+
+	for y, changes := range rows {
+		row := bitmap.Data[y*stride : (y+1)*stride]
+
+		for i := 0; i < len(changes); i += 2 {
+			end := columns
+			if i+1 < len(changes) {
+				end = changes[i+1]
+			}
+
+			for x := changes[i]; x < end; x++ {
+				if black_is_1 {
+					row[x/8] |= 0x80 >> (x % 8)
+				} else {
+					row[x/8] &^= 0x80 >> (x % 8)
+				}
+			}
+		}
+	}
+
+	return bitmap
+}
@@ -0,0 +1,116 @@
+package pdfobjects
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Eight pixel wide rows coded by hand from the code tables of T.4 and T.6.
+// Set bits are white unless /BlackIs1 is true.
+var FAX_SAMPLES = []struct {
+	name string
+	data string
+	k int
+	rows int
+	black_is_1 bool
+	expected string
+}{
+	// Four white rows, each a single V0, followed by EOFB.
+	{"g4 white", "f0010010", -1, 0, false, "ffffffff"},
+	// White 2, black 3, white 3 in horizontal mode, then V0 V0 V0 for the
+	// same row and VR1 VL1 V0 for white 3, black 1, white 4, then EOFB.
+	{"g4 modes", "2f7b50010010", -1, 0, false, "c7c7ef"},
+	{"g4 black is 1", "2f7b50010010", -1, 0, true, "383810"},
+	// The first row of "g4 modes" as one-dimensional run lengths.
+	{"g3 1d", "7a00", 0, 1, false, "c7"},
+}
+
+func TestDecodeCCITTFax(t *testing.T) {
+	for _, sample := range FAX_SAMPLES {
+		data, _ := hex.DecodeString(sample.data)
+		parms := pdftypes.PdfDict{
+			pdftypes.K: pdftypes.PdfInteger(sample.k),
+			pdftypes.COLUMNS: pdftypes.PdfInteger(8),
+			pdftypes.BLACKIS1: pdftypes.PdfBool(sample.black_is_1),
+		}
+		if sample.rows > 0 {
+			parms[pdftypes.ROWS] = pdftypes.PdfInteger(sample.rows)
+		}
+
+		bitmap, err := DecodeCCITTFax(data, parms)
+		if err != nil {
+			t.Errorf("%s: %v", sample.name, err)
+			continue
+		}
+		if got := hex.EncodeToString(bitmap.Data); got != sample.expected || bitmap.Width != 8 {
+			t.Errorf("%s: got %s, %d wide, expected %s", sample.name, got, bitmap.Width, sample.expected)
+		}
+	}
+}
+
+func TestDecodeCCITTFaxPixels(t *testing.T) {
+	data, _ := hex.DecodeString("2f7b50010010")
+	for _, black_is_1 := range []bool{false, true} {
+		parms := pdftypes.PdfDict{
+			pdftypes.K: pdftypes.PdfInteger(-1),
+			pdftypes.COLUMNS: pdftypes.PdfInteger(8),
+			pdftypes.BLACKIS1: pdftypes.PdfBool(black_is_1),
+		}
+
+		bitmap, err := DecodeCCITTFax(data, parms)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bitmap.Height != 3 {
+			t.Fatalf("Expected 3 rows, got %d", bitmap.Height)
+		}
+		for x := 0; x < 8; x++ {
+			if black := x >= 2 && x < 5; bitmap.IsBlack(x, 0) != black {
+				t.Errorf("BlackIs1 %v: pixel %d of row 0 should be black: %v", black_is_1, x, black)
+			}
+		}
+	}
+}
+
+func TestDecodeCCITTFaxLimit(t *testing.T) {
+	data, _ := hex.DecodeString("f0010010")
+	parms := pdftypes.PdfDict{
+		pdftypes.K: pdftypes.PdfInteger(-1),
+		pdftypes.COLUMNS: pdftypes.PdfInteger(8),
+	}
+
+	_, err := decodeCCITTFax(data, parms, 2)
+	if !errors.Is(err, pdftypes.ErrLimitExceeded) {
+		t.Errorf("Expected limit error, got %v", err)
+	}
+}
+
+// Parameters that used to overflow the size of the bitmap and panic.
+var FAX_INVALID_PARMS = []pdftypes.PdfDict{
+	{pdftypes.K: pdftypes.PdfInteger(-1), pdftypes.COLUMNS: pdftypes.PdfInteger(9223372036854775800), pdftypes.ROWS: pdftypes.PdfInteger(16)},
+	{pdftypes.K: pdftypes.PdfInteger(-1), pdftypes.COLUMNS: pdftypes.PdfInteger(8), pdftypes.ROWS: pdftypes.PdfInteger(9223372036854775800)},
+	{pdftypes.K: pdftypes.PdfInteger(-1), pdftypes.COLUMNS: pdftypes.PdfInteger(FAX_MAX_COLUMNS + 1)},
+	{pdftypes.K: pdftypes.PdfInteger(-1), pdftypes.COLUMNS: pdftypes.PdfInteger(0)},
+	{pdftypes.K: pdftypes.PdfInteger(-1), pdftypes.COLUMNS: pdftypes.PdfInteger(-8)},
+	{pdftypes.K: pdftypes.PdfInteger(-1), pdftypes.COLUMNS: pdftypes.PdfInteger(8), pdftypes.ROWS: pdftypes.PdfInteger(0)},
+	{pdftypes.K: pdftypes.PdfInteger(-1), pdftypes.COLUMNS: pdftypes.PdfInteger(8), pdftypes.ROWS: pdftypes.PdfInteger(-16)},
+}
+
+func TestDecodeCCITTFaxInvalidSize(t *testing.T) {
+	// Only an end-of-block code.
+	data, _ := hex.DecodeString("001001")
+	for _, parms := range FAX_INVALID_PARMS {
+		for _, limit := range []int64{0, DEFAULT_MAX_STREAM_SIZE} {
+			filter := Filter{pdftypes.CCITTFAXDECODE, parms, true, limit}
+			_, err := filter.Decode(data)
+
+			var pdf_err *pdftypes.PdfError
+			if !errors.As(err, &pdf_err) || pdf_err.Kind != pdftypes.DECODE_ERROR {
+				t.Errorf("%v: expected decode error, got %v", parms, err)
+			}
+		}
+	}
+}
@@ -101,6 +101,10 @@ func removeBrackets(line string) string {
 
 func parseCMapSingle(line string, cmap *CMap) {
 	split := strings.SplitN(cleanBfChar(line), " ", 2)
+	if len(split) < 2 {
+		// Skip malformed mappings.
+		return
+	}
 	from, to := split[0], split[1]
 
 	single := CMapSingle{from, to}
@@ -114,6 +118,10 @@ func parseHex(str string) (int, error) {
 
 func parseCMapRange(line string, cmap *CMap) {
 	split := strings.SplitN(cleanBfChar(line), " ", 3)
+	if len(split) < 3 {
+		// Skip malformed mappings.
+		return
+	}
 
 	if strings.HasSuffix(split[2], "]") {
 		from, to := split[0], removeBrackets(split[2])
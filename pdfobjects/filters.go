@@ -0,0 +1,345 @@
+package pdfobjects
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"errors"
+	"io"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Wrapped by errors returned together with data that could only be decoded
+// in part. The data decoded before the corruption is still returned.
+var ErrPartialDecode = errors.New("Stream was only partially decoded")
+
+// A filter applied to the data of a stream, with its parameters
+// (`/DecodeParms`). `Parms` is nil if the filter has no parameters.
+// A `Tolerant` filter decodes corrupt data as far as possible. `Limit` is
+// the maximum size of the decoded data in bytes, 0 for no limit.
+type Filter struct {
+	Name pdftypes.PdfName
+	Parms pdftypes.PdfDict
+	Tolerant bool
+	Limit int64
+}
+
+// Full names of the abbreviated filter names allowed in inline images.
+var filterAbbreviations = map[pdftypes.PdfName]pdftypes.PdfName{
+	pdftypes.AHX: pdftypes.ASCIIHEXDECODE,
+	pdftypes.A85: pdftypes.ASCII85DECODE,
+	pdftypes.LZW: pdftypes.LZWDECODE,
+	pdftypes.FL: pdftypes.FLATEDECODE,
+	pdftypes.RL: pdftypes.RUNLENGTHDECODE,
+	pdftypes.CCF: pdftypes.CCITTFAXDECODE,
+	pdftypes.DCT: pdftypes.DCTDECODE,
+}
+
+// Check whether the filter decodes image data, which holds no text.
+func (f Filter) IsImage() bool {
+	switch f.Name {
+	case pdftypes.CCITTFAXDECODE, pdftypes.JBIG2DECODE, pdftypes.DCTDECODE, pdftypes.JPXDECODE:
+		return true
+	}
+	return false
+}
+
+// Get the filters of the stream of the object in the order they are applied
+// when decoding, each with its entry of `/DecodeParms`.
+func (pobj PdfObject) Filters() ([]Filter, error) {
+	value, ok := pobj.dict.Get(pdftypes.FILTER)
+	if !ok {
+		return nil, nil
+	}
+
+	// A single filter has a single dictionary of parameters.
+	if name, ok := value.(pdftypes.PdfName); ok {
+		parms, _ := pobj.dict.GetDict(pdftypes.DECODEPARMS, nil)
+		return []Filter{pobj.newFilter(name, parms)}, nil
+	}
+
+	names, ok := value.(pdftypes.PdfArray)
+	if !ok {
+		return nil, pdftypes.Errorf(pdftypes.SYNTAX_ERROR, -1, "Invalid /Filter.")
+	}
+
+	// Parameters of several filters are given as an array, with null
+	// for filters without parameters. A single filter in an array may
+	// have a single dictionary of parameters instead.
+	parms, _ := pobj.dict.GetArray(pdftypes.DECODEPARMS, nil)
+	if dict, err := pobj.dict.GetDict(pdftypes.DECODEPARMS, nil); err == nil && len(names) == 1 {
+		parms = pdftypes.PdfArray{dict}
+	}
+
+	filters := make([]Filter, len(names))
+	for i := range names {
+		name, err := names.GetName(i, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		dict, _ := parms.GetDict(i, nil)
+		filters[i] = pobj.newFilter(name, dict)
+	}
+
+	return filters, nil
+}
+
+// Create a filter of the stream of the object, expanding abbreviated names.
+func (pobj PdfObject) newFilter(name pdftypes.PdfName, parms pdftypes.PdfDict) Filter {
+	if full, ok := filterAbbreviations[name]; ok {
+		name = full
+	}
+	return Filter{name, parms, pobj.tolerant, pobj.limiter.Limits().MaxStreamSize}
+}
+
+// Apply the filter to `data`.
+// Returns an error of kind `LIMIT_ERROR` if the decoded data exceeds `Limit`.
+func (f Filter) Decode(data []byte) ([]byte, error) {
+	decoded, err := f.decode(data)
+	if err != nil && !errors.Is(err, ErrPartialDecode) {
+		return nil, err
+	}
+
+	if serr := checkStreamSize(len(decoded), f.Limit); serr != nil {
+		return nil, serr
+	}
+	return decoded, err
+}
+
+// Apply the filter to `data`, without checking the size of the result.
+// Filters that can expand data a lot stop decoding once `Limit` is exceeded.
+func (f Filter) decode(data []byte) ([]byte, error) {
+	switch f.Name {
+	case pdftypes.ASCIIHEXDECODE:
+		return decodeASCIIHex(data)
+
+	case pdftypes.ASCII85DECODE:
+		return decodeASCII85(data)
+
+	case pdftypes.LZWDECODE:
+		early_change := int64(1)
+		if value, err := f.Parms.GetInt(pdftypes.EARLYCHANGE, nil); err == nil {
+			early_change = value
+		}
+
+		decoded, err := decodeLZW(data, int(early_change), f.Limit)
+		if err != nil {
+			return nil, err
+		}
+		return Unpredict(decoded, f.Parms)
+
+	case pdftypes.FLATEDECODE:
+		var decoded []byte
+		var err error
+		if f.Tolerant {
+			decoded, err = decodeFlateTolerant(data, f.Limit)
+		} else {
+			decoded, err = decodeFlate(data, f.Limit)
+		}
+		if err != nil && !errors.Is(err, ErrPartialDecode) {
+			return nil, err
+		}
+
+		// A partially decoded stream keeps its error.
+		predicted, perr := Unpredict(decoded, f.Parms)
+		if perr != nil {
+			return nil, perr
+		}
+		return predicted, err
+
+	case pdftypes.RUNLENGTHDECODE:
+		return decodeRunLength(data, f.Limit)
+
+	case pdftypes.CCITTFAXDECODE:
+		bitmap, err := decodeCCITTFax(data, f.Parms, f.Limit)
+		if err != nil {
+			return nil, err
+		}
+		return bitmap.Data, nil
+
+	case pdftypes.CRYPT:
+		// Streams are decrypted when read, only the identity filter remains.
+		if name, err := f.Parms.GetName(pdftypes.NAME, nil); err == nil && name != pdftypes.IDENTITY {
+			return nil, pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "Unsupported crypt filter: %s", name)
+		}
+		return data, nil
+
+	default:
+		return nil, pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "Unsupported stream encoding: %s", f.Name)
+	}
+}
+
+// Apply `filters` to `data` in order.
+// If a filter only decodes the data in part, the remaining filters are
+// applied to that part, and the error wrapping `ErrPartialDecode` is
+// returned along with the data.
+func decodeFilters(data []byte, filters []Filter) ([]byte, error) {
+	var partial error
+
+	for _, filter := range filters {
+		decoded, err := filter.Decode(data)
+		if errors.Is(err, ErrPartialDecode) {
+			partial = err
+		} else if _, ok := err.(*pdftypes.PdfError); ok {
+			return nil, err
+		} else if err != nil {
+			return nil, pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "%s: %w", filter.Name, err)
+		}
+		data = decoded
+	}
+
+	return data, partial
+}
+
+// Decode hexadecimal data up to the end marker `>`. Whitespace is ignored
+// and a final odd digit is followed by 0.
+func decodeASCIIHex(data []byte) ([]byte, error) {
+	decoded := make([]byte, 0, len(data)/2)
+	high, odd := byte(0), false
+
+	for _, b := range data {
+		var digit byte
+		switch {
+		case b >= '0' && b <= '9':
+			digit = b - '0'
+		case b >= 'a' && b <= 'f':
+			digit = b - 'a' + 10
+		case b >= 'A' && b <= 'F':
+			digit = b - 'A' + 10
+		case b == '>':
+			if odd {
+				decoded = append(decoded, high<<4)
+			}
+			return decoded, nil
+		case b == 0 || b == '\t' || b == '\n' || b == '\f' || b == '\r' || b == ' ':
+			continue
+		default:
+			return nil, pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "Invalid hexadecimal digit %q", b)
+		}
+
+		if odd {
+			decoded = append(decoded, high<<4|digit)
+		} else {
+			high = digit
+		}
+		odd = !odd
+	}
+
+	if odd {
+		decoded = append(decoded, high<<4)
+	}
+	return decoded, nil
+}
+
+// Decode ASCII base-85 data up to the end marker `~>`.
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimLeft(data, "\x00\t\n\f\r ")
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if end := bytes.Index(data, []byte("~>")); end >= 0 {
+		data = data[:end]
+	}
+
+	return io.ReadAll(ascii85.NewDecoder(bytes.NewReader(data)))
+}
+
+// Decode run-length encoded data up to the end marker 128. Each run starts
+// with a length byte: 0 to 127 for 1 to 128 bytes copied as they are, and
+// 129 to 255 for the next byte repeated 257 minus the length times.
+// Truncated data is decoded as far as it goes. Decoding stops with an error
+// once more than `limit` bytes are decoded, unless it is 0.
+func decodeRunLength(data []byte, limit int64) ([]byte, error) {
+	decoded := make([]byte, 0, len(data)*2)
+
+	for len(data) > 0 {
+		length := int(data[0])
+		data = data[1:]
+
+		switch {
+		case length < 128:
+			n := length + 1
+			if n > len(data) {
+				n = len(data)
+			}
+			decoded = append(decoded, data[:n]...)
+			data = data[n:]
+
+		case length > 128 && len(data) > 0:
+			for i := 0; i < 257-length; i++ {
+				decoded = append(decoded, data[0])
+			}
+			data = data[1:]
+
+		default:
+			return decoded, nil
+		}
+
+		if err := checkStreamSize(len(decoded), limit); err != nil {
+			return nil, err
+		}
+	}
+
+	return decoded, nil
+}
+
+// Decode zlib compressed data, at most `limit` bytes unless it is 0.
+func decodeFlate(data []byte, limit int64) ([]byte, error) {
+	rc, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return readLimited(rc, limit)
+}
+
+// Read everything from `r`, failing once more than `limit` bytes are read
+// unless it is 0. Returns the bytes read before any other error.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if serr := checkStreamSize(len(data), limit); serr != nil {
+		return nil, serr
+	}
+	return data, err
+}
+
+// Decode zlib compressed data that may be corrupt.
+//
+// Streams with a broken or missing zlib header are decoded as raw deflate
+// data, and the output decoded before any corruption is kept. If the data
+// could not be decoded completely, the error wraps `ErrPartialDecode`.
+// The decoded data is nil if nothing could be decoded.
+func decodeFlateTolerant(data []byte, limit int64) ([]byte, error) {
+	decoded, err := decodeFlate(data, limit)
+	if err == nil || errors.Is(err, pdftypes.ErrLimitExceeded) {
+		return decoded, err
+	}
+
+	// Keep the longest output of reading the data as zlib data,
+	// as raw deflate data and as raw deflate data after a zlib header.
+	best, cause := decoded, err
+	for _, offset := range []int{0, 2} {
+		if offset > len(data) {
+			break
+		}
+
+		raw, err := readLimited(flate.NewReader(bytes.NewReader(data[offset:])), limit)
+		if err == nil || errors.Is(err, pdftypes.ErrLimitExceeded) {
+			return raw, err
+		}
+		if len(raw) > len(best) {
+			best = raw
+		}
+	}
+
+	if len(best) == 0 {
+		return nil, pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "%s: %w", pdftypes.FLATEDECODE, cause)
+	}
+
+	return best, pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "%w after %d bytes: %v", ErrPartialDecode, len(best), cause)
+}
@@ -0,0 +1,46 @@
+package pdfobjects
+
+import (
+	"strings"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Get the text entries of the document information dictionary (`/Info`),
+// such as the title and author, keyed by name without the leading slash.
+// Entries that are not text strings, e.g. `/Trapped`, are left out.
+func (pdf Pdf) DocumentInfo() (map[string]string, error) {
+	entries := make(map[string]string)
+
+	ref, ok := pdf.Info()
+	if !ok {
+		return entries, nil
+	}
+
+	value, err := pdf.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	info, ok := value.(pdftypes.PdfDict)
+	if !ok {
+		return nil, pdftypes.Errorf(pdftypes.REFERENCE_ERROR, -1, "Document information %v is not a dictionary.", ref)
+	}
+
+	for key, value := range info {
+		if resolved, err := pdf.Resolve(value); err == nil {
+			value = resolved
+		}
+
+		name, ok := key.(pdftypes.PdfName)
+		if !ok {
+			continue
+		}
+
+		if text, ok := pdftypes.TextString(value); ok {
+			entries[strings.TrimPrefix(string(name), "/")] = text
+		}
+	}
+
+	return entries, nil
+}
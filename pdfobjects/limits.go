@@ -0,0 +1,124 @@
+package pdfobjects
+
+import (
+	"sync/atomic"
+	"time"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Default limits on the resources used to read a document.
+const (
+	DEFAULT_MAX_STREAM_SIZE = 256 << 20
+	DEFAULT_MAX_DECODED_BYTES = 1 << 30
+	DEFAULT_MAX_DEPTH = 256
+	DEFAULT_MAX_OBJECTS = 1 << 22
+	DEFAULT_TIMEOUT = 5 * time.Minute
+)
+
+// Limits on the resources used to read a single document, guarding against
+// hostile files. A zero value means that there is no limit.
+//
+// `MaxStreamSize` is the decoded size of a single stream in bytes, and
+// `MaxDecodedBytes` the decoded size of all streams of the document.
+// `MaxDepth` is the nesting depth of arrays and dictionaries, `MaxObjects`
+// the number of objects in the document, and `Timeout` the time from starting
+// to read the document until its streams have been extracted.
+type Limits struct {
+	MaxStreamSize int64
+	MaxDecodedBytes int64
+	MaxDepth int
+	MaxObjects int
+	Timeout time.Duration
+}
+
+// Get the default limits.
+func DefaultLimits() Limits {
+	return Limits{
+		DEFAULT_MAX_STREAM_SIZE,
+		DEFAULT_MAX_DECODED_BYTES,
+		DEFAULT_MAX_DEPTH,
+		DEFAULT_MAX_OBJECTS,
+		DEFAULT_TIMEOUT,
+	}
+}
+
+// Enforces `Limits` while a document is read. Shared by the objects of the
+// document and safe for concurrent use. A nil `Limiter` enforces no limits.
+type Limiter struct {
+	limits Limits
+	deadline time.Time
+	decoded int64
+}
+
+// Create a new `Limiter` enforcing `limits`. The timeout starts now.
+func NewLimiter(limits Limits) *Limiter {
+	deadline := time.Time{}
+	if limits.Timeout > 0 {
+		deadline = time.Now().Add(limits.Timeout)
+	}
+
+	return &Limiter{
+		limits,
+		deadline,
+		0,
+	}
+}
+
+// Get the limits enforced.
+func (l *Limiter) Limits() Limits {
+	if l == nil {
+		return Limits{}
+	}
+	return l.limits
+}
+
+// Check whether the time to read the document has run out.
+func (l *Limiter) CheckDeadline() error {
+	if l == nil || l.deadline.IsZero() || time.Now().Before(l.deadline) {
+		return nil
+	}
+	return limitError("Timeout of %v exceeded", l.limits.Timeout)
+}
+
+// Check the nesting depth of a value being parsed.
+func (l *Limiter) CheckDepth(depth int) error {
+	if l == nil || l.limits.MaxDepth <= 0 || depth <= l.limits.MaxDepth {
+		return nil
+	}
+	return limitError("Nesting depth exceeds %d", l.limits.MaxDepth)
+}
+
+// Check the number of objects of the document.
+func (l *Limiter) CheckObjects(count int) error {
+	if l == nil || l.limits.MaxObjects <= 0 || count <= l.limits.MaxObjects {
+		return nil
+	}
+	return limitError("Number of objects exceeds %d", l.limits.MaxObjects)
+}
+
+// Count `n` decoded bytes towards the total of the document.
+func (l *Limiter) AddDecoded(n int) error {
+	if l == nil {
+		return nil
+	}
+
+	total := atomic.AddInt64(&l.decoded, int64(n))
+	if l.limits.MaxDecodedBytes > 0 && total > l.limits.MaxDecodedBytes {
+		return limitError("Decoded size of the document exceeds %d bytes", l.limits.MaxDecodedBytes)
+	}
+	return nil
+}
+
+// Check the decoded size of a single stream against `limit`, 0 for no limit.
+func checkStreamSize(size int, limit int64) error {
+	if limit <= 0 || int64(size) <= limit {
+		return nil
+	}
+	return limitError("Decoded size of the stream exceeds %d bytes", limit)
+}
+
+// Create an error of kind `LIMIT_ERROR` with a formatted message.
+func limitError(format string, args ...interface{}) error {
+	return pdftypes.Errorf(pdftypes.LIMIT_ERROR, -1, "%w: "+format, append([]interface{}{pdftypes.ErrLimitExceeded}, args...)...)
+}
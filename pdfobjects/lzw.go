@@ -0,0 +1,88 @@
+package pdfobjects
+
+import (
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Special codes and limits of the LZW variant used by pdf.
+const (
+	LZW_CLEAR = 256
+	LZW_EOD = 257
+	LZW_FIRST = 258
+	LZW_MIN_WIDTH = 9
+	LZW_MAX_WIDTH = 12
+)
+
+// Decode LZW compressed data as specified for `/LZWDecode`.
+//
+// Codes are 9 to 12 bits, most significant bit first. With `early_change`
+// set to 1, the default, the code width grows one code earlier than needed.
+// Data ending without an end-of-data code is returned as far as it goes.
+// Decoding stops with an error once more than `limit` bytes are decoded,
+// unless it is 0.
+func decodeLZW(data []byte, early_change int, limit int64) ([]byte, error) {
+	decoded := make([]byte, 0, len(data)*2)
+	table := make([][]byte, LZW_FIRST, 1<<LZW_MAX_WIDTH)
+	for i := 0; i < 256; i++ {
+		table[i] = []byte{byte(i)}
+	}
+
+	width := LZW_MIN_WIDTH
+	var prev []byte
+
+	// Bits not yet consumed, stored in the low bits of `buffer`.
+	var buffer uint32
+	bits := 0
+
+	for len(data) > 0 || bits >= width {
+		for bits < width && len(data) > 0 {
+			buffer = buffer<<8 | uint32(data[0])
+			data = data[1:]
+			bits += 8
+		}
+		if bits < width {
+			break
+		}
+
+		code := int(buffer>>(bits-width)) & (1<<width - 1)
+		bits -= width
+
+		switch {
+		case code == LZW_CLEAR:
+			table = table[:LZW_FIRST]
+			width = LZW_MIN_WIDTH
+			prev = nil
+			continue
+
+		case code == LZW_EOD:
+			return decoded, nil
+		}
+
+		var entry []byte
+		switch {
+		case code < len(table) && code != LZW_CLEAR && code != LZW_EOD:
+			entry = table[code]
+		case code == len(table) && prev != nil:
+			// The code being defined by this very step.
+			entry = append(append(make([]byte, 0, len(prev)+1), prev...), prev[0])
+		default:
+			return nil, pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "Invalid LZW code %d", code)
+		}
+
+		decoded = append(decoded, entry...)
+		if err := checkStreamSize(len(decoded), limit); err != nil {
+			return nil, err
+		}
+
+		if prev != nil && len(table) < cap(table) {
+			table = append(table, append(append(make([]byte, 0, len(prev)+1), prev...), entry[0]))
+		}
+		prev = entry
+
+		if len(table)+early_change >= 1<<width && width < LZW_MAX_WIDTH {
+			width++
+		}
+	}
+
+	return decoded, nil
+}
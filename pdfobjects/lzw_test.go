@@ -0,0 +1,63 @@
+package pdfobjects
+
+import (
+	"bytes"
+	"compress/lzw"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// The example from the pdf specification, 7.4.4.2. The codes are all nine
+// bits wide, so both values of /EarlyChange decode it the same way.
+const LZW_EXAMPLE = "800b6050220c0c8501"
+const LZW_EXAMPLE_DECODED = "2d2d2d2d2d412d2d2d42"
+
+func TestDecodeLZWExample(t *testing.T) {
+	data, _ := hex.DecodeString(LZW_EXAMPLE)
+	for _, early_change := range []int{0, 1} {
+		decoded, err := decodeLZW(data, early_change, 0)
+		if err != nil {
+			t.Errorf("EarlyChange %d: %v", early_change, err)
+			continue
+		}
+		if hex.EncodeToString(decoded) != LZW_EXAMPLE_DECODED {
+			t.Errorf("EarlyChange %d: got %x, expected %s", early_change, decoded, LZW_EXAMPLE_DECODED)
+		}
+	}
+}
+
+// Data compressed by compress/lzw, which grows the code width without the
+// early change, long enough to use all code widths and a clear code.
+func TestDecodeLZWWidths(t *testing.T) {
+	var plain bytes.Buffer
+	for i := 0; plain.Len() < 64*1024; i++ {
+		fmt.Fprintf(&plain, "%d %x ", i, i*i)
+	}
+
+	var compressed bytes.Buffer
+	writer := lzw.NewWriter(&compressed, lzw.MSB, 8)
+	writer.Write(plain.Bytes())
+	writer.Close()
+
+	decoded, err := decodeLZW(compressed.Bytes(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, plain.Bytes()) {
+		t.Errorf("Decoded %d bytes, expected %d", len(decoded), plain.Len())
+	}
+}
+
+func TestDecodeLZWLimit(t *testing.T) {
+	data, _ := hex.DecodeString(LZW_EXAMPLE)
+	_, err := decodeLZW(data, 1, 4)
+
+	var pdf_err *pdftypes.PdfError
+	if !errors.As(err, &pdf_err) || pdf_err.Kind != pdftypes.LIMIT_ERROR || !errors.Is(err, pdftypes.ErrLimitExceeded) {
+		t.Errorf("Expected limit error, got %v", err)
+	}
+}
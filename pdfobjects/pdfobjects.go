@@ -2,6 +2,7 @@ package pdfobjects
 
 import (
 	"errors"
+	"sync"
 
 	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
 )
@@ -11,7 +12,75 @@ type Pdf struct {
 	name string
 	version string
 	objects []*PdfObject
+	index map[pdftypes.PdfReference]*PdfObject
+	indexMutex *sync.RWMutex
+	versions map[pdftypes.PdfReference][]*PdfObject
 	count int
+	xref map[int]XrefEntry
+	trailer pdftypes.PdfDict
+	repairs []Repair
+	revisions []revision
+	loader Loader
+	references []pdftypes.PdfReference
+	reached *reachedIndex
+	superseded []SupersededEntry
+}
+
+// Source of the objects of a `Pdf` in lazy mode.
+// The methods must be safe for concurrent use.
+type Loader interface {
+	// Load the object referenced by `ref`.
+	LoadObject(ref pdftypes.PdfReference) (*PdfObject, error)
+	// Load the version of object `number` located by `entry`,
+	// e.g. one written by an older revision.
+	LoadEntry(number int, entry XrefEntry) (*PdfObject, error)
+}
+
+// Location of an object written by revision `Revision` that a later
+// revision replaced or deleted. Loaded on demand in lazy mode.
+type SupersededEntry struct {
+	Number int
+	Revision int
+	Entry XrefEntry
+}
+
+// Entry in the cross-reference table.
+//
+// Records where an object is located in the file and whether it is in use.
+// Objects stored in an object stream are marked as `Compressed` and located
+// by the object number of the stream and their index within it.
+type XrefEntry struct {
+	Offset int64
+	Generation int
+	InUse bool
+	Compressed bool
+	Stream int
+	Index int
+}
+
+// Check whether `e` and `other` locate an object at the same place in the file.
+func (e XrefEntry) SameLocation(other XrefEntry) bool {
+	if e.Compressed || other.Compressed {
+		return e.Compressed == other.Compressed && e.Stream == other.Stream && e.Index == other.Index
+	}
+	return e.Offset == other.Offset
+}
+
+// Problem in the file that was worked around while reading it.
+//
+// `Err` is the error that would have been returned if the file had not been
+// read in repair mode, and `Action` describes what was done instead.
+type Repair struct {
+	Action string
+	Err error
+}
+
+// Stringer implementation for Repair.
+func (r Repair) String() string {
+	if r.Err == nil {
+		return r.Action
+	}
+	return r.Action + ": " + r.Err.Error()
 }
 
 // Create a new empty `Pdf` struct.
@@ -20,7 +89,18 @@ func NewPdf(name string) *Pdf {
 		name,
 		"",
 		make([]*PdfObject, 0),
+		make(map[pdftypes.PdfReference]*PdfObject),
+		&sync.RWMutex{},
+		make(map[pdftypes.PdfReference][]*PdfObject),
 		0,
+		make(map[int]XrefEntry),
+		make(pdftypes.PdfDict),
+		make([]Repair, 0),
+		make([]revision, 0),
+		nil,
+		nil,
+		nil,
+		nil,
 	}
 }
 
@@ -40,30 +120,329 @@ func (pdf Pdf) Version() string {
 }
 
 // Append a `PdfObject` to the wrappers internal list of objects.
+// If an object with the same reference was appended before,
+// lookups by reference will return the new object.
 func (pdf *Pdf) AppendObject(obj *PdfObject) {
 	pdf.objects = append(pdf.objects, obj)
+	pdf.index[obj.pos] = obj
+	pdf.versions[obj.pos] = append(pdf.versions[obj.pos], obj)
+	pdf.count++
+}
+
+// Append an object that was replaced or deleted by a later revision.
+// It is part of the list of objects, but lookups by reference ignore it.
+func (pdf *Pdf) AppendSupersededObject(obj *PdfObject) {
+	obj.superseded = true
+	pdf.objects = append(pdf.objects, obj)
+	pdf.versions[obj.pos] = append(pdf.versions[obj.pos], obj)
 	pdf.count++
 }
 
-// Return the number of read objects.
+// Switch the `Pdf` to lazy mode, where the objects referenced by `references`
+// are loaded with `loader` when they are requested instead of being kept in
+// memory. Objects are classified by reachability as they are loaded, once
+// `AnalyzeReachability` has been called, and superseded objects added with
+// `AddSupersededEntry` are loaded after the others.
+func (pdf *Pdf) SetLoader(loader Loader, references []pdftypes.PdfReference) {
+	pdf.loader = loader
+	pdf.references = references
+}
+
+// Add the location of a superseded object in lazy mode. It is counted among
+// the objects after those referenced by `References`, and loaded on demand.
+func (pdf *Pdf) AddSupersededEntry(entry SupersededEntry) {
+	pdf.superseded = append(pdf.superseded, entry)
+}
+
+// Check whether objects are loaded on demand.
+func (pdf Pdf) IsLazy() bool {
+	return pdf.loader != nil
+}
+
+// Return the references of the objects loaded on demand.
+func (pdf Pdf) References() []pdftypes.PdfReference {
+	return pdf.references
+}
+
+// Drop the object referenced by `ref` from memory in lazy mode.
+// It is loaded again if it is requested later. Has no effect otherwise.
+func (pdf *Pdf) Release(ref pdftypes.PdfReference) {
+	if pdf.IsLazy() {
+		pdf.indexMutex.Lock()
+		delete(pdf.index, ref)
+		pdf.indexMutex.Unlock()
+	}
+}
+
+// Return the number of objects.
 func (pdf Pdf) Count() int {
+	if pdf.IsLazy() {
+		return len(pdf.references) + len(pdf.superseded)
+	}
 	return pdf.count
 }
 
 // Return object with index `i`.
-func (pdf Pdf) GetObject(i int) (*PdfObject, error) {
-	if i >= pdf.Count() {
+// In lazy mode, the object is loaded each time and not kept in memory.
+func (pdf Pdf) ObjectAt(i int) (*PdfObject, error) {
+	if i < 0 || i >= pdf.Count() {
 		return nil, errors.New("Index out of Bounds.")
+	} else if pdf.IsLazy() && i >= len(pdf.references) {
+		return pdf.loadSuperseded(pdf.superseded[i-len(pdf.references)])
+	} else if pdf.IsLazy() {
+		obj, err := pdf.loader.LoadObject(pdf.references[i])
+		if err != nil {
+			return nil, err
+		}
+		pdf.classify(obj)
+		return obj, nil
 	} else {
 		return pdf.objects[i], nil
 	}
 }
 
+// Load the superseded object located by `entry` in lazy mode.
+func (pdf Pdf) loadSuperseded(entry SupersededEntry) (*PdfObject, error) {
+	obj, err := pdf.loader.LoadEntry(entry.Number, entry.Entry)
+	if err != nil {
+		return nil, err
+	}
+
+	obj.SetRevision(entry.Revision)
+	obj.superseded = true
+	obj.reachability = SUPERSEDED
+	return obj, nil
+}
+
+// Return the object referenced by `ref`.
+// In lazy mode, the object is loaded and kept until it is released.
+// Safe for concurrent use once the document has been read.
+func (pdf Pdf) GetObject(ref pdftypes.PdfReference) (*PdfObject, error) {
+	pdf.indexMutex.RLock()
+	obj, ok := pdf.index[ref]
+	pdf.indexMutex.RUnlock()
+	if ok {
+		return obj, nil
+	}
+
+	if pdf.IsLazy() {
+		obj, err := pdf.loader.LoadObject(ref)
+		if err != nil {
+			return nil, err
+		}
+		pdf.classify(obj)
+
+		// Another caller may have loaded the object meanwhile.
+		pdf.indexMutex.Lock()
+		if loaded, ok := pdf.index[ref]; ok {
+			obj = loaded
+		} else {
+			pdf.index[ref] = obj
+		}
+		pdf.indexMutex.Unlock()
+		return obj, nil
+	}
+
+	return nil, pdftypes.Errorf(pdftypes.REFERENCE_ERROR, -1, "Object %v not found.", ref)
+}
+
+// Add an entry to the cross-reference table for object number `number`.
+// Entries that are already present are not overwritten, as cross-reference
+// sections are read from the newest to the oldest.
+func (pdf *Pdf) AddXrefEntry(number int, entry XrefEntry) {
+	if _, ok := pdf.xref[number]; !ok {
+		pdf.xref[number] = entry
+	}
+}
+
+// Look up the cross-reference entry for object number `number`.
+func (pdf Pdf) XrefEntry(number int) (XrefEntry, bool) {
+	entry, ok := pdf.xref[number]
+	return entry, ok
+}
+
+// Return the complete cross-reference table.
+func (pdf Pdf) Xref() map[int]XrefEntry {
+	return pdf.xref
+}
+
+// Update the trailer dictionary of the file.
+func (pdf *Pdf) SetTrailer(trailer pdftypes.PdfDict) {
+	pdf.trailer = trailer
+}
+
+// Retrieve the trailer dictionary of the file.
+func (pdf Pdf) Trailer() pdftypes.PdfDict {
+	return pdf.trailer
+}
+
+// Get the reference to the document catalog (`/Root`).
+func (pdf Pdf) Root() (pdftypes.PdfReference, bool) {
+	root, ok := pdf.trailer[pdftypes.ROOT].(pdftypes.PdfReference)
+	return root, ok
+}
+
+// Get the reference to the document information dictionary (`/Info`).
+func (pdf Pdf) Info() (pdftypes.PdfReference, bool) {
+	info, ok := pdf.trailer[pdftypes.INFO].(pdftypes.PdfReference)
+	return info, ok
+}
+
+// Get the file identifiers (`/ID`). Returns nil if the file has none.
+func (pdf Pdf) ID() pdftypes.PdfArray {
+	id, _ := pdf.trailer[pdftypes.ID].(pdftypes.PdfArray)
+	return id
+}
+
+// Record that a problem in the file was worked around while reading it.
+func (pdf *Pdf) AddRepair(action string, err error) {
+	pdf.repairs = append(pdf.repairs, Repair{action, err})
+}
+
+// Return the repairs made while reading the file, in the order they were made.
+// The list is empty if the file was read without problems.
+func (pdf Pdf) Repairs() []Repair {
+	return pdf.repairs
+}
+
+// Get the number of entries in the cross-reference table (`/Size`).
+func (pdf Pdf) Size() int {
+	size, _ := pdftypes.IntValue(pdf.trailer[pdftypes.SIZE])
+	return int(size)
+}
+
+// Follow `value` if it is a reference and return the value of the
+// referenced object. References to references are followed as well.
+// Values of other types are returned as they are.
+func (pdf Pdf) Resolve(value pdftypes.PdfDataType) (pdftypes.PdfDataType, error) {
+	return resolve(value, pdf.GetObject)
+}
+
+// Follow references in `value`, looking up objects with `get`.
+func resolve(value pdftypes.PdfDataType, get func(pdftypes.PdfReference) (*PdfObject, error)) (pdftypes.PdfDataType, error) {
+	visited := make(map[pdftypes.PdfReference]bool)
+
+	for {
+		ref, ok := value.(pdftypes.PdfReference)
+		if !ok {
+			return value, nil
+		}
+
+		if visited[ref] {
+			return nil, pdftypes.Errorf(pdftypes.REFERENCE_ERROR, -1, "Reference cycle detected at %v.", ref)
+		}
+		visited[ref] = true
+
+		obj, err := get(ref)
+		if err != nil {
+			return nil, err
+		}
+
+		value = obj.Value()
+	}
+}
+
+// Look up `key` in `dict` and resolve the value if it is a reference.
+func (pdf Pdf) ResolveKey(dict pdftypes.PdfDict, key pdftypes.PdfName) (pdftypes.PdfDataType, error) {
+	value, ok := dict.Get(key)
+	if !ok {
+		return nil, pdftypes.Errorf(pdftypes.REFERENCE_ERROR, -1, "%w: %s", pdftypes.ErrKeyNotFound, key)
+	}
+
+	return pdf.Resolve(value)
+}
+
+// Follow the reference `value` to the object holding a stream.
+func (pdf Pdf) ResolveStream(value pdftypes.PdfDataType) (*PdfObject, error) {
+	return resolveStream(value, pdf.GetObject)
+}
+
+// Follows references to the objects holding streams.
+// Implemented by `Pdf` and `PdfRevision`.
+type StreamResolver interface {
+	ResolveStream(value pdftypes.PdfDataType) (*PdfObject, error)
+}
+
+// Get the object holding the stream referenced by `key` in `dict`.
+// Streams are always stored in objects of their own, so the value of
+// `key` must be a reference.
+//
+// This is the stream accessor of the typed accessors of `pdftypes.PdfDict`,
+// which cannot return a `PdfObject` themselves.
+func GetStream(dict pdftypes.PdfDict, key pdftypes.PdfName, resolver StreamResolver) (*PdfObject, error) {
+	value, ok := dict.Get(key)
+	if !ok {
+		return nil, pdftypes.Errorf(pdftypes.REFERENCE_ERROR, -1, "%w: %s", pdftypes.ErrKeyNotFound, key)
+	}
+
+	return resolver.ResolveStream(value)
+}
+
+// Get the object holding the stream referenced by `key` in `dict`.
+func (pdf Pdf) GetStream(dict pdftypes.PdfDict, key pdftypes.PdfName) (*PdfObject, error) {
+	return GetStream(dict, key, pdf)
+}
+
+// Follow references in `value` to an object with a stream,
+// looking up objects with `get`.
+func resolveStream(value pdftypes.PdfDataType, get func(pdftypes.PdfReference) (*PdfObject, error)) (*PdfObject, error) {
+	visited := make(map[pdftypes.PdfReference]bool)
+
+	for {
+		ref, ok := value.(pdftypes.PdfReference)
+		if !ok {
+			return nil, pdftypes.Errorf(pdftypes.SYNTAX_ERROR, -1, "%w: expected stream", pdftypes.ErrUnexpectedType)
+		}
+
+		if visited[ref] {
+			return nil, pdftypes.Errorf(pdftypes.REFERENCE_ERROR, -1, "Reference cycle detected at %v.", ref)
+		}
+		visited[ref] = true
+
+		obj, err := get(ref)
+		if err != nil {
+			return nil, err
+		}
+
+		if obj.HasStream() {
+			return obj, nil
+		}
+		value = obj.Value()
+	}
+}
+
+// Get the length of the stream of `pobj` (`/Length`),
+// which may be given as a reference to another object.
+func (pdf Pdf) StreamLength(pobj *PdfObject) (int, error) {
+	value, err := pdf.ResolveKey(pobj.dict, pdftypes.LENGTH)
+	if err != nil {
+		return 0, pdftypes.WithReference(err, pdftypes.REFERENCE_ERROR, pobj.pos)
+	}
+
+	length, ok := pdftypes.IntValue(value)
+	if !ok || length < 0 {
+		return 0, pdftypes.WithReference(
+			pdftypes.Errorf(pdftypes.SYNTAX_ERROR, -1, "Invalid stream length."),
+			pdftypes.SYNTAX_ERROR,
+			pobj.pos,
+		)
+	}
+
+	return int(length), nil
+}
+
 // Wrapper for pdf object.
 type PdfObject struct {
 	pos pdftypes.PdfReference
 	dict pdftypes.PdfDict
+	value pdftypes.PdfDataType
 	Stream PdfStream
+	revision int
+	superseded bool
+	reachability Reachability
+	tolerant bool
+	limiter *Limiter
+	names map[pdftypes.PdfName]string
 }
 
 // Create a new empty `PdfObject`.
@@ -71,15 +450,87 @@ func NewPdfObject() *PdfObject {
 	return &PdfObject{
 		pdftypes.PdfReference{Object: 0, Generation: 0},
 		make(pdftypes.PdfDict, 0),
+		nil,
 		PdfStream{},
+		0,
+		false,
+		REACHABLE,
+		false,
+		nil,
+		nil,
 	}
 }
 
+// Update the object number and generation of the PdfObject.
+func (pobj *PdfObject) SetReference(ref pdftypes.PdfReference) {
+	pobj.pos = ref
+}
+
+// Retrieve the object number and generation of the PdfObject.
+func (pobj PdfObject) Reference() pdftypes.PdfReference {
+	return pobj.pos
+}
+
+// Update the revision of the document in which the object was written.
+func (pobj *PdfObject) SetRevision(revision int) {
+	pobj.revision = revision
+}
+
+// Retrieve the revision of the document in which the object was written.
+// The original document is revision 0.
+func (pobj PdfObject) Revision() int {
+	return pobj.revision
+}
+
+// Enable or disable tolerant decoding of the stream of the object.
+//
+// With tolerant decoding, corrupt Flate data is decoded as far as possible
+// instead of failing, and the stream is reported as partially decoded.
+func (pobj *PdfObject) SetTolerantDecoding(tolerant bool) {
+	pobj.tolerant = tolerant
+}
+
+// Set the limiter enforcing the limits of the document when decoding the
+// stream of the object. A nil limiter enforces no limits.
+func (pobj *PdfObject) SetLimiter(limiter *Limiter) {
+	pobj.limiter = limiter
+}
+
+// Check whether the object was replaced or deleted by a later revision.
+func (pobj PdfObject) IsSuperseded() bool {
+	return pobj.superseded
+}
+
+// Retrieve the dictionary associated with the PdfObject.
+func (pobj PdfObject) Dict() pdftypes.PdfDict {
+	return pobj.dict
+}
+
 // Update the dictionary associated with the PdfObject.
 func (pobj *PdfObject) SetDict(dict pdftypes.PdfDict) {
 	pobj.dict = dict
 }
 
+// Retrieve the value of the PdfObject. This is the dictionary,
+// unless the object holds some other value.
+func (pobj PdfObject) Value() pdftypes.PdfDataType {
+	if pobj.value != nil {
+		return pobj.value
+	}
+
+	return pobj.dict
+}
+
+// Update the value of the PdfObject.
+func (pobj *PdfObject) SetValue(value pdftypes.PdfDataType) {
+	if dict, ok := value.(pdftypes.PdfDict); ok {
+		pobj.dict = dict
+		pobj.value = nil
+	} else {
+		pobj.value = value
+	}
+}
+
 // Helper function for extracting the stream of the PdfObject.
 func (pobj *PdfObject) ExtractStream(cmap *CMap) (string, bool, error) {
 	stream, process, err := pobj.Stream.Extract(pobj, cmap)
@@ -121,11 +572,59 @@ func (pobj PdfObject) IsEncoded() bool {
 	return pobj.dict[pdftypes.FILTER] != nil
 }
 
+// Decode the stream of the object with its filters and their parameters.
+func (pobj PdfObject) DecodeStream() ([]byte, error) {
+	filters, err := pobj.Filters()
+	if err != nil {
+		return nil, pdftypes.WithReference(err, pdftypes.DECODE_ERROR, pobj.pos)
+	}
+
+	// Partially decoded data is returned along with its error.
+	data, err := pobj.Stream.Decode(filters)
+	if err != nil && !errors.Is(err, ErrPartialDecode) {
+		return nil, pdftypes.WithReference(err, pdftypes.DECODE_ERROR, pobj.pos)
+	}
+
+	if lerr := pobj.limiter.AddDecoded(len(data)); lerr != nil {
+		return nil, pdftypes.WithReference(lerr, pdftypes.DECODE_ERROR, pobj.pos)
+	}
+
+	return data, pdftypes.WithReference(err, pdftypes.DECODE_ERROR, pobj.pos)
+}
+
+// Set the source text of the names of the object that were written with
+// `#xx` escapes, keyed by the decoded name.
+func (pobj *PdfObject) SetRawNames(names map[pdftypes.PdfName]string) {
+	pobj.names = names
+}
+
+// Get `name` as it was written in the object, e.g. `/Flate#44ecode` for
+// `/FlateDecode`. If the object spells the name in several ways, the first
+// is returned. Names written without escapes are returned as they are.
+func (pobj PdfObject) RawName(name pdftypes.PdfName) string {
+	if raw, ok := pobj.names[name]; ok {
+		return raw
+	}
+	return string(name)
+}
+
+// Check whether the object holds a stream.
+func (pobj PdfObject) HasStream() bool {
+	return pobj.Stream.streamtype != ""
+}
+
 // Get the encoding type of the associated stream.
+// Returns an empty name if the stream is not encoded, and the only filter
+// if `/Filter` is an array with a single element.
 func (pobj PdfObject) GetEncoding() pdftypes.PdfName {
-	if !pobj.IsEncoded() {
-		return ""
+	if name, err := pobj.dict.GetName(pdftypes.FILTER, nil); err == nil {
+		return name
+	}
+
+	if filters, err := pobj.dict.GetArray(pdftypes.FILTER, nil); err == nil && len(filters) == 1 {
+		name, _ := filters.GetName(0, nil)
+		return name
 	}
 
-	return pobj.dict[pdftypes.FILTER].(pdftypes.PdfName) 
+	return ""
 }
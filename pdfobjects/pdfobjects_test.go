@@ -0,0 +1,74 @@
+package pdfobjects
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Objects are loaded and released from several goroutines in lazy mode, as
+// in the pipeline. Run with -race to check the access to the index.
+func TestGetObjectConcurrent(t *testing.T) {
+	objects, trailer := reachabilitySample()
+	loader := &countingLoader{sync.Mutex{}, objects, 0}
+
+	pdf := NewPdf("test.pdf")
+	pdf.SetTrailer(trailer)
+	pdf.SetLoader(loader, []pdftypes.PdfReference{ref(1), ref(2), ref(3), ref(4), ref(5)})
+	pdf.AnalyzeReachability()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 1; n <= len(objects); n++ {
+				obj, err := pdf.GetObject(ref(n))
+				if err != nil || obj.Reference() != ref(n) {
+					t.Errorf("Got %v, %v for %v", obj, err, ref(n))
+				}
+				pdf.Release(ref(n))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Streams are found through references, with a `Pdf` or a `PdfRevision`.
+func TestGetStream(t *testing.T) {
+	stream := NewPdfObject()
+	stream.SetReference(ref(2))
+	stream.SetDict(pdftypes.PdfDict{pdftypes.LENGTH: pdftypes.PdfInteger(5)})
+	stream.Stream = NewPdfStream("stream", []byte("Hello"))
+
+	indirect := NewPdfObject()
+	indirect.SetReference(ref(1))
+	indirect.SetValue(ref(2))
+
+	pdf := NewPdf("test.pdf")
+	pdf.AppendObject(indirect)
+	pdf.AppendObject(stream)
+
+	key := pdftypes.NewPdfName("/Contents")
+	for _, value := range []pdftypes.PdfDataType{ref(1), ref(2)} {
+		dict := pdftypes.PdfDict{key: value}
+
+		obj, err := GetStream(dict, key, pdf)
+		if err != nil || obj != stream {
+			t.Errorf("%v: got %v, %v", value, obj, err)
+		}
+		if obj, err := pdf.GetStream(dict, key); err != nil || obj != stream {
+			t.Errorf("%v: got %v, %v with Pdf.GetStream", value, obj, err)
+		}
+	}
+
+	dict := pdftypes.PdfDict{key: pdftypes.PdfInteger(1)}
+	if _, err := GetStream(dict, key, pdf); !errors.Is(err, pdftypes.ErrUnexpectedType) {
+		t.Errorf("Got %v, expected %v", err, pdftypes.ErrUnexpectedType)
+	}
+	if _, err := GetStream(dict, pdftypes.LENGTH, pdf); !errors.Is(err, pdftypes.ErrKeyNotFound) {
+		t.Errorf("Got %v, expected %v", err, pdftypes.ErrKeyNotFound)
+	}
+}
@@ -0,0 +1,229 @@
+package pdfobjects
+
+import (
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Predictor values of `/DecodeParms`.
+const (
+	PREDICTOR_NONE = 1
+	PREDICTOR_TIFF = 2
+	// Values from 10 and up select PNG prediction. The predictor is then
+	// chosen per row, so the exact value does not matter.
+	PREDICTOR_PNG = 10
+)
+
+// PNG filter types, given by the first byte of each row.
+const (
+	PNG_NONE = iota
+	PNG_SUB
+	PNG_UP
+	PNG_AVERAGE
+	PNG_PAETH
+)
+
+// Layout of predicted data, read from `/DecodeParms`.
+type predictorParms struct {
+	predictor int
+	colors int
+	bits int
+	columns int
+}
+
+// Read the predictor parameters from `parms`, using the default values
+// for missing entries.
+func readPredictorParms(parms pdftypes.PdfDict) (predictorParms, error) {
+	get := func(key pdftypes.PdfName, fallback int) int {
+		if value, err := parms.GetInt(key, nil); err == nil {
+			return int(value)
+		}
+		return fallback
+	}
+
+	p := predictorParms{
+		get(pdftypes.PREDICTOR, PREDICTOR_NONE),
+		get(pdftypes.COLORS, 1),
+		get(pdftypes.BITSPERCOMPONENT, 8),
+		get(pdftypes.COLUMNS, 1),
+	}
+
+	switch p.bits {
+	case 1, 2, 4, 8, 16:
+	default:
+		return p, pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "Invalid /BitsPerComponent: %d", p.bits)
+	}
+
+	if p.colors < 1 || p.colors > 32 || p.columns < 1 {
+		return p, pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "Invalid /Colors or /Columns")
+	}
+
+	return p, nil
+}
+
+// Number of bytes in a row of samples.
+func (p predictorParms) rowLength() int {
+	return (p.colors*p.bits*p.columns + 7) / 8
+}
+
+// Number of bytes per pixel, at least 1, as used by PNG prediction.
+func (p predictorParms) pixelLength() int {
+	if n := p.colors * p.bits / 8; n > 0 {
+		return n
+	}
+	return 1
+}
+
+// Reverse the prediction selected by `/Predictor` in `parms` on data decoded
+// by `/FlateDecode` or `/LZWDecode`. Data is returned as it is without
+// a predictor.
+func Unpredict(data []byte, parms pdftypes.PdfDict) ([]byte, error) {
+	p, err := readPredictorParms(parms)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.predictor == PREDICTOR_NONE || len(data) == 0 {
+		return data, nil
+	}
+
+	// Rows longer than the data are rejected before their length is computed,
+	// which could overflow for huge values of /Columns.
+	if p.columns > len(data)*8/(p.colors*p.bits) {
+		return nil, pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "/Columns %d exceeds the length of the data", p.columns)
+	}
+
+	switch {
+	case p.predictor >= PREDICTOR_PNG:
+		return unpredictPNG(data, p)
+	case p.predictor == PREDICTOR_TIFF:
+		return unpredictTIFF(data, p), nil
+	default:
+		return nil, pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "Unsupported stream predictor: %d", p.predictor)
+	}
+}
+
+// Reverse PNG prediction. Each row is prefixed with a byte selecting the
+// filter type. A truncated last row is decoded as far as it goes.
+func unpredictPNG(data []byte, p predictorParms) ([]byte, error) {
+	columns, bpp := p.rowLength(), p.pixelLength()
+
+	decoded := make([]byte, 0, len(data)/(columns+1)*columns)
+	prev := make([]byte, columns)
+
+	for len(data) > 1 {
+		filter, row := data[0], data[1:]
+		if len(row) > columns {
+			row = row[:columns]
+		}
+		data = data[1+len(row):]
+		current := make([]byte, columns)
+
+		for i := range row {
+			var left, up, upleft byte
+			if i >= bpp {
+				left, upleft = current[i-bpp], prev[i-bpp]
+			}
+			up = prev[i]
+
+			switch filter {
+			case PNG_NONE:
+				current[i] = row[i]
+			case PNG_SUB:
+				current[i] = row[i] + left
+			case PNG_UP:
+				current[i] = row[i] + up
+			case PNG_AVERAGE:
+				current[i] = row[i] + byte((int(left)+int(up))/2)
+			case PNG_PAETH:
+				current[i] = row[i] + paeth(left, up, upleft)
+			default:
+				return nil, pdftypes.Errorf(pdftypes.DECODE_ERROR, -1, "Invalid PNG filter type: %d", filter)
+			}
+		}
+
+		decoded = append(decoded, current[:len(row)]...)
+		prev = current
+	}
+
+	return decoded, nil
+}
+
+// The Paeth predictor function from the PNG specification.
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+
+	if pa <= pb && pa <= pc {
+		return a
+	} else if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Reverse TIFF predictor 2, where each sample is stored as the difference
+// to the same component of the pixel to its left. Rows are independent.
+func unpredictTIFF(data []byte, p predictorParms) []byte {
+	columns := p.rowLength()
+	decoded := make([]byte, len(data))
+	copy(decoded, data)
+
+	for start := 0; start < len(decoded); start += columns {
+		end := start + columns
+		if end > len(decoded) {
+			end = len(decoded)
+		}
+		row := decoded[start:end]
+
+		switch p.bits {
+		case 8:
+			for i := p.colors; i < len(row); i++ {
+				row[i] += row[i-p.colors]
+			}
+
+		case 16:
+			for i := 2 * p.colors; i+1 < len(row); i += 2 {
+				j := i - 2*p.colors
+				sum := (uint16(row[i])<<8 | uint16(row[i+1])) + (uint16(row[j])<<8 | uint16(row[j+1]))
+				row[i], row[i+1] = byte(sum>>8), byte(sum)
+			}
+
+		default:
+			// Samples smaller than a byte are added modulo their size.
+			// Padding bits at the end of the row are left alone.
+			samples := len(row) * 8 / p.bits
+			if samples > p.colors*p.columns {
+				samples = p.colors * p.columns
+			}
+			mask := 1<<p.bits - 1
+			for i := p.colors; i < samples; i++ {
+				sum := (sample(row, i, p.bits) + sample(row, i-p.colors, p.bits)) & mask
+				setSample(row, i, p.bits, sum)
+			}
+		}
+	}
+
+	return decoded
+}
+
+// Get sample number `i` of `bits` bits from `row`, most significant bits first.
+func sample(row []byte, i int, bits int) int {
+	offset := i * bits
+	shift := 8 - bits - offset%8
+	return int(row[offset/8]>>shift) & (1<<bits - 1)
+}
+
+// Set sample number `i` of `bits` bits in `row` to `value`.
+func setSample(row []byte, i int, bits int, value int) {
+	offset := i * bits
+	shift := 8 - bits - offset%8
+	mask := byte((1<<bits - 1) << shift)
+	row[offset/8] = row[offset/8]&^mask | byte(value<<shift)&mask
+}
@@ -0,0 +1,136 @@
+package pdfobjects
+
+import (
+	"bytes"
+	"testing"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Build `/DecodeParms` for `predictor` with the given sample layout.
+func predictorParmsDict(predictor, colors, bits, columns int) pdftypes.PdfDict {
+	return pdftypes.PdfDict{
+		pdftypes.PREDICTOR: pdftypes.PdfInteger(predictor),
+		pdftypes.COLORS: pdftypes.PdfInteger(colors),
+		pdftypes.BITSPERCOMPONENT: pdftypes.PdfInteger(bits),
+		pdftypes.COLUMNS: pdftypes.PdfInteger(columns),
+	}
+}
+
+func TestUnpredict(t *testing.T) {
+	tests := []struct {
+		name string
+		parms pdftypes.PdfDict
+		data []byte
+		expected []byte
+	}{
+		{
+			"no predictor",
+			pdftypes.PdfDict{},
+			[]byte{1, 2, 3},
+			[]byte{1, 2, 3},
+		},
+		{
+			// One row of each filter type, then a truncated row.
+			"PNG filter types",
+			predictorParmsDict(PREDICTOR_PNG, 1, 8, 3),
+			[]byte{
+				PNG_NONE, 1, 2, 3,
+				PNG_SUB, 1, 1, 1,
+				PNG_UP, 1, 1, 1,
+				PNG_AVERAGE, 2, 2, 2,
+				PNG_PAETH, 1, 1, 1,
+				PNG_UP, 1,
+			},
+			[]byte{1, 2, 3, 1, 2, 3, 2, 3, 4, 3, 5, 6, 4, 6, 7, 5},
+		},
+		{
+			// The predictor value does not select the filter type.
+			"PNG optimum",
+			predictorParmsDict(15, 1, 8, 2),
+			[]byte{PNG_SUB, 1, 1, PNG_UP, 1, 1},
+			[]byte{1, 2, 2, 3},
+		},
+		{
+			"PNG pixels of three bytes",
+			predictorParmsDict(PREDICTOR_PNG, 3, 8, 2),
+			[]byte{PNG_SUB, 10, 20, 30, 1, 1, 1},
+			[]byte{10, 20, 30, 11, 21, 31},
+		},
+		{
+			"PNG wraps around",
+			predictorParmsDict(PREDICTOR_PNG, 1, 8, 2),
+			[]byte{PNG_SUB, 200, 100},
+			[]byte{200, 44},
+		},
+		{
+			"TIFF 8 bits",
+			predictorParmsDict(PREDICTOR_TIFF, 1, 8, 4),
+			[]byte{1, 1, 1, 1, 5, 0, 0, 1},
+			[]byte{1, 2, 3, 4, 5, 5, 5, 6},
+		},
+		{
+			"TIFF 8 bits, three colors",
+			predictorParmsDict(PREDICTOR_TIFF, 3, 8, 2),
+			[]byte{10, 20, 30, 1, 2, 3},
+			[]byte{10, 20, 30, 11, 22, 33},
+		},
+		{
+			"TIFF 16 bits",
+			predictorParmsDict(PREDICTOR_TIFF, 1, 16, 2),
+			[]byte{0x01, 0xff, 0x00, 0x01},
+			[]byte{0x01, 0xff, 0x02, 0x00},
+		},
+		{
+			"TIFF 1 bit",
+			predictorParmsDict(PREDICTOR_TIFF, 1, 1, 8),
+			[]byte{0x80},
+			[]byte{0xff},
+		},
+		{
+			"TIFF 2 bits",
+			predictorParmsDict(PREDICTOR_TIFF, 1, 2, 4),
+			[]byte{0x57},
+			[]byte{0x6e},
+		},
+		{
+			// The padding at the end of each row is left alone.
+			"TIFF 4 bits with padding",
+			predictorParmsDict(PREDICTOR_TIFF, 1, 4, 3),
+			[]byte{0x11, 0x1f, 0x21, 0x1f},
+			[]byte{0x12, 0x3f, 0x23, 0x4f},
+		},
+	}
+
+	for _, test := range tests {
+		decoded, err := Unpredict(test.data, test.parms)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(decoded, test.expected) {
+			t.Errorf("%s: got %v, expected %v", test.name, decoded, test.expected)
+		}
+	}
+}
+
+func TestUnpredictInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		parms pdftypes.PdfDict
+		data []byte
+	}{
+		{"PNG filter type", predictorParmsDict(PREDICTOR_PNG, 1, 8, 2), []byte{5, 1, 1}},
+		{"predictor", predictorParmsDict(3, 1, 8, 2), []byte{1, 1}},
+		{"bits per component", predictorParmsDict(PREDICTOR_TIFF, 1, 3, 2), []byte{1, 1}},
+		{"colors", predictorParmsDict(PREDICTOR_TIFF, 0, 8, 2), []byte{1, 1}},
+		{"columns", predictorParmsDict(PREDICTOR_PNG, 1, 8, 0), []byte{1, 1}},
+		{"huge columns", predictorParmsDict(PREDICTOR_PNG, 32, 16, 1<<62), []byte{1, 1}},
+	}
+
+	for _, test := range tests {
+		if decoded, err := Unpredict(test.data, test.parms); err == nil {
+			t.Errorf("%s: expected an error, got %v", test.name, decoded)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package pdfobjects
+
+import (
+	"sync"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Classification of an object by whether the document still uses it.
+type Reachability int
+
+const (
+	// Referenced, directly or indirectly, from the trailer.
+	REACHABLE Reachability = iota
+	// Present in the file, but not referenced by the document.
+	ORPHANED
+	// Replaced or deleted by a later revision of the document.
+	SUPERSEDED
+)
+
+// Stringer implementation for Reachability.
+func (r Reachability) String() string {
+	switch r {
+	case REACHABLE:
+		return "reachable"
+	case ORPHANED:
+		return "orphaned"
+	default:
+		return "superseded"
+	}
+}
+
+// References reached from the trailer in lazy mode, found the first time
+// an object is classified.
+type reachedIndex struct {
+	once sync.Once
+	reached map[pdftypes.PdfReference]bool
+}
+
+// Classify every object of the document by following references from the
+// trailer. Superseded objects stay superseded whether referenced or not.
+//
+// Object streams, cross-reference streams and the linearization dictionary
+// are part of the file structure and are never referenced, so they count
+// as reachable.
+//
+// In lazy mode, nothing is loaded here. Objects are classified as they are
+// loaded, once the references reached have been found on first use.
+func (pdf *Pdf) AnalyzeReachability() {
+	if pdf.IsLazy() {
+		pdf.reached = &reachedIndex{}
+		return
+	}
+
+	reached := reachedFrom(pdf.trailer, func(ref pdftypes.PdfReference) (pdftypes.PdfDataType, bool) {
+		obj, ok := pdf.index[ref]
+		if !ok {
+			return nil, false
+		}
+		return obj.Value(), true
+	})
+
+	for _, obj := range pdf.objects {
+		switch {
+		case obj.superseded:
+			obj.reachability = SUPERSEDED
+		case reached[obj.pos] && pdf.index[obj.pos] == obj || obj.isStructural():
+			obj.reachability = REACHABLE
+		default:
+			obj.reachability = ORPHANED
+		}
+	}
+}
+
+// Find the references reached from `root`. A reference is followed to the
+// value `follow` returns for it, and only counts if `follow` finds one.
+func reachedFrom(
+	root pdftypes.PdfDataType,
+	follow func(pdftypes.PdfReference) (pdftypes.PdfDataType, bool),
+) map[pdftypes.PdfReference]bool {
+	reached := make(map[pdftypes.PdfReference]bool)
+	stack := []pdftypes.PdfDataType{root}
+
+	for len(stack) > 0 {
+		value := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch v := value.(type) {
+		case pdftypes.PdfReference:
+			if reached[v] {
+				continue
+			}
+
+			target, ok := follow(v)
+			if !ok {
+				continue
+			}
+
+			reached[v] = true
+			stack = append(stack, target)
+
+		case pdftypes.PdfDict:
+			for _, element := range v {
+				stack = append(stack, element)
+			}
+
+		case pdftypes.PdfArray:
+			for _, element := range v {
+				stack = append(stack, element)
+			}
+		}
+	}
+
+	return reached
+}
+
+// Find the references reached from the trailer in lazy mode.
+//
+// Every object is loaded once, in the order of `references`, so that each
+// object stream is only decoded once, and only the references each object
+// holds are kept.
+func (pdf Pdf) findReached() map[pdftypes.PdfReference]bool {
+	held := make(map[pdftypes.PdfReference]pdftypes.PdfArray, len(pdf.references))
+
+	for _, ref := range pdf.references {
+		obj, err := pdf.loader.LoadObject(ref)
+		if err != nil {
+			continue
+		}
+
+		direct := reachedFrom(obj.Value(), func(pdftypes.PdfReference) (pdftypes.PdfDataType, bool) {
+			return nil, true
+		})
+
+		refs := make(pdftypes.PdfArray, 0, len(direct))
+		for ref := range direct {
+			refs = append(refs, ref)
+		}
+		held[obj.pos] = refs
+	}
+
+	return reachedFrom(pdf.trailer, func(ref pdftypes.PdfReference) (pdftypes.PdfDataType, bool) {
+		refs, ok := held[ref]
+		return refs, ok
+	})
+}
+
+// Classify an object loaded in lazy mode. The references reached are found
+// when the first object is classified. Objects stay reachable if
+// `AnalyzeReachability` was not run.
+func (pdf Pdf) classify(obj *PdfObject) {
+	if pdf.reached == nil {
+		return
+	}
+
+	index := pdf.reached
+	index.once.Do(func() {
+		index.reached = pdf.findReached()
+	})
+
+	if index.reached[obj.pos] || obj.isStructural() {
+		obj.reachability = REACHABLE
+	} else {
+		obj.reachability = ORPHANED
+	}
+}
+
+// Check whether the object only describes the structure of the file.
+func (pobj PdfObject) isStructural() bool {
+	switch pobj.GetType() {
+	case pdftypes.OBJSTM, pdftypes.XREFSTREAM:
+		return true
+	}
+
+	_, ok := pobj.dict[pdftypes.LINEARIZED]
+	return ok
+}
+
+// Retrieve the reachability of the object, as classified by
+// `Pdf.AnalyzeReachability`.
+func (pobj PdfObject) Reachability() Reachability {
+	return pobj.reachability
+}
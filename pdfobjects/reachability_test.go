@@ -0,0 +1,112 @@
+package pdfobjects
+
+import (
+	"sync"
+	"testing"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Loads objects from memory and counts the loads.
+type countingLoader struct {
+	mutex sync.Mutex
+	objects map[pdftypes.PdfReference]pdftypes.PdfDataType
+	loads int
+}
+
+func (l *countingLoader) LoadObject(ref pdftypes.PdfReference) (*PdfObject, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.loads++
+	value, ok := l.objects[ref]
+	if !ok {
+		return nil, pdftypes.Errorf(pdftypes.REFERENCE_ERROR, -1, "Object %v not found.", ref)
+	}
+
+	obj := NewPdfObject()
+	obj.SetReference(ref)
+	obj.SetValue(value)
+	return obj, nil
+}
+
+func (l *countingLoader) LoadEntry(number int, entry XrefEntry) (*PdfObject, error) {
+	return l.LoadObject(ref(number))
+}
+
+func ref(number int) pdftypes.PdfReference {
+	return pdftypes.PdfReference{Object: number}
+}
+
+// A catalog with a page tree, where object 4 is not referenced and
+// object 5 is only referenced by it.
+func reachabilitySample() (map[pdftypes.PdfReference]pdftypes.PdfDataType, pdftypes.PdfDict) {
+	objects := map[pdftypes.PdfReference]pdftypes.PdfDataType{
+		ref(1): pdftypes.PdfDict{pdftypes.OBJ_TYPE: pdftypes.CATALOG, pdftypes.PAGES: ref(2)},
+		ref(2): pdftypes.PdfDict{pdftypes.NewPdfName("/Kids"): pdftypes.PdfArray{ref(3)}},
+		ref(3): pdftypes.PdfDict{pdftypes.NewPdfName("/Parent"): ref(2)},
+		ref(4): pdftypes.PdfDict{pdftypes.NewPdfName("/Kids"): pdftypes.PdfArray{ref(5)}},
+		ref(5): pdftypes.PdfInteger(42),
+	}
+	trailer := pdftypes.PdfDict{pdftypes.ROOT: ref(1)}
+	return objects, trailer
+}
+
+var EXPECTED_REACHABILITY = map[pdftypes.PdfReference]Reachability{
+	ref(1): REACHABLE,
+	ref(2): REACHABLE,
+	ref(3): REACHABLE,
+	ref(4): ORPHANED,
+	ref(5): ORPHANED,
+}
+
+func TestAnalyzeReachability(t *testing.T) {
+	objects, trailer := reachabilitySample()
+
+	pdf := NewPdf("test.pdf")
+	pdf.SetTrailer(trailer)
+	for i := 1; i <= len(objects); i++ {
+		obj := NewPdfObject()
+		obj.SetReference(ref(i))
+		obj.SetValue(objects[ref(i)])
+		pdf.AppendObject(obj)
+	}
+	pdf.AnalyzeReachability()
+
+	for i := 0; i < pdf.Count(); i++ {
+		obj, _ := pdf.ObjectAt(i)
+		if expected := EXPECTED_REACHABILITY[obj.Reference()]; obj.Reachability() != expected {
+			t.Errorf("%v: got %v, expected %v", obj.Reference(), obj.Reachability(), expected)
+		}
+	}
+}
+
+// In lazy mode, nothing is loaded until the first object is classified, and
+// then each object is loaded once to find the references reached.
+func TestAnalyzeReachabilityLazy(t *testing.T) {
+	objects, trailer := reachabilitySample()
+	loader := &countingLoader{sync.Mutex{}, objects, 0}
+
+	pdf := NewPdf("test.pdf")
+	pdf.SetTrailer(trailer)
+	pdf.SetLoader(loader, []pdftypes.PdfReference{ref(1), ref(2), ref(3), ref(4), ref(5)})
+	pdf.AnalyzeReachability()
+
+	if loader.loads != 0 {
+		t.Errorf("%d objects loaded before classifying", loader.loads)
+	}
+
+	for i := 0; i < pdf.Count(); i++ {
+		obj, err := pdf.ObjectAt(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := EXPECTED_REACHABILITY[obj.Reference()]; obj.Reachability() != expected {
+			t.Errorf("%v: got %v, expected %v", obj.Reference(), obj.Reachability(), expected)
+		}
+	}
+
+	if expected := 2 * len(objects); loader.loads != expected {
+		t.Errorf("%d objects loaded, expected %d", loader.loads, expected)
+	}
+}
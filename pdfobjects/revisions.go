@@ -0,0 +1,205 @@
+package pdfobjects
+
+import (
+	"fmt"
+	"sort"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+// Cross-reference section and trailer written by one revision of a document.
+type revision struct {
+	xref map[int]XrefEntry
+	trailer pdftypes.PdfDict
+}
+
+// Add a revision with the cross-reference entries `xref` and `trailer`.
+// Revisions are added from the newest to the oldest, as cross-reference
+// sections are read following `/Prev`.
+func (pdf *Pdf) AddRevision(xref map[int]XrefEntry, trailer pdftypes.PdfDict) {
+	pdf.revisions = append([]revision{{xref, trailer}}, pdf.revisions...)
+}
+
+// Return the number of revisions of the document.
+// A document without incremental updates has a single revision.
+func (pdf Pdf) RevisionCount() int {
+	if len(pdf.revisions) == 0 {
+		return 1
+	}
+	return len(pdf.revisions)
+}
+
+// Get a view of the document as it was at revision `n`.
+// The original document is revision 0.
+func (pdf *Pdf) Revision(n int) (PdfRevision, error) {
+	if n < 0 || n >= pdf.RevisionCount() {
+		return PdfRevision{}, fmt.Errorf("Revision %d not found.", n)
+	}
+
+	return PdfRevision{pdf, n}, nil
+}
+
+// Get the sections of all revisions, from the oldest to the newest.
+// Documents read without a cross-reference table have a single section.
+func (pdf Pdf) sections() []revision {
+	if len(pdf.revisions) == 0 {
+		return []revision{{pdf.xref, pdf.trailer}}
+	}
+	return pdf.revisions
+}
+
+// View of a document as it was at a given revision.
+//
+// Objects replaced by later revisions are visible in the state they had at
+// the revision, and objects added later are not visible at all.
+type PdfRevision struct {
+	pdf *Pdf
+	number int
+}
+
+// Get the number of the revision.
+func (rev PdfRevision) Number() int {
+	return rev.number
+}
+
+// Retrieve the trailer dictionary written by the revision.
+func (rev PdfRevision) Trailer() pdftypes.PdfDict {
+	return rev.pdf.sections()[rev.number].trailer
+}
+
+// Get the reference to the document catalog (`/Root`) of the revision.
+func (rev PdfRevision) Root() (pdftypes.PdfReference, bool) {
+	root, ok := rev.Trailer()[pdftypes.ROOT].(pdftypes.PdfReference)
+	return root, ok
+}
+
+// Return the cross-reference entries written by the revision itself,
+// i.e. the objects it added, changed or deleted.
+func (rev PdfRevision) Updates() map[int]XrefEntry {
+	return rev.pdf.sections()[rev.number].xref
+}
+
+// Look up the cross-reference entry for object number `number`
+// as it was at the revision.
+func (rev PdfRevision) XrefEntry(number int) (XrefEntry, bool) {
+	entry, _, ok := rev.findEntry(number)
+	return entry, ok
+}
+
+// Look up the cross-reference entry for object number `number` as it was at
+// the revision, along with the revision that wrote it.
+func (rev PdfRevision) findEntry(number int) (XrefEntry, int, bool) {
+	sections := rev.pdf.sections()
+
+	for i := rev.number; i >= 0; i-- {
+		if entry, ok := sections[i].xref[number]; ok {
+			return entry, i, true
+		}
+	}
+
+	return XrefEntry{}, 0, false
+}
+
+// Return the object referenced by `ref` as it was at the revision.
+// In lazy mode, versions replaced by later revisions are loaded each time.
+func (rev PdfRevision) GetObject(ref pdftypes.PdfReference) (*PdfObject, error) {
+	if entry, ok := rev.XrefEntry(ref.Object); ok && !entry.InUse {
+		return nil, pdftypes.Errorf(pdftypes.REFERENCE_ERROR, -1, "Object %v not in use at revision %d.", ref, rev.number)
+	}
+
+	if rev.pdf.IsLazy() {
+		return rev.loadObject(ref)
+	}
+
+	// The newest version written at or before the revision.
+	var found *PdfObject
+	for _, obj := range rev.pdf.versions[ref] {
+		if obj.revision <= rev.number && (found == nil || obj.revision >= found.revision) {
+			found = obj
+		}
+	}
+
+	if found == nil {
+		return nil, pdftypes.Errorf(pdftypes.REFERENCE_ERROR, -1, "Object %v not found at revision %d.", ref, rev.number)
+	}
+
+	return found, nil
+}
+
+// Load the object referenced by `ref` as it was at the revision in lazy mode.
+func (rev PdfRevision) loadObject(ref pdftypes.PdfReference) (*PdfObject, error) {
+	entry, number, ok := rev.findEntry(ref.Object)
+	if !ok {
+		return nil, pdftypes.Errorf(pdftypes.REFERENCE_ERROR, -1, "Object %v not found at revision %d.", ref, rev.number)
+	}
+
+	if current, ok := rev.pdf.XrefEntry(ref.Object); ok && current.SameLocation(entry) {
+		return rev.pdf.GetObject(ref)
+	}
+
+	return rev.pdf.loadSuperseded(SupersededEntry{ref.Object, number, entry})
+}
+
+// Follow `value` if it is a reference and return the value of the
+// referenced object as it was at the revision.
+func (rev PdfRevision) Resolve(value pdftypes.PdfDataType) (pdftypes.PdfDataType, error) {
+	return resolve(value, rev.GetObject)
+}
+
+// Follow the reference `value` to the object holding a stream,
+// as it was at the revision.
+func (rev PdfRevision) ResolveStream(value pdftypes.PdfDataType) (*PdfObject, error) {
+	return resolveStream(value, rev.GetObject)
+}
+
+// Return the objects of the document as it was at the revision.
+// In lazy mode, every object of the revision is loaded.
+func (rev PdfRevision) Objects() []*PdfObject {
+	objects := make([]*PdfObject, 0)
+
+	if rev.pdf.IsLazy() {
+		for _, number := range rev.numbers() {
+			entry, _ := rev.XrefEntry(number)
+			ref := pdftypes.PdfReference{Object: number}
+			if !entry.Compressed {
+				ref.Generation = entry.Generation
+			}
+
+			if obj, err := rev.GetObject(ref); err == nil {
+				objects = append(objects, obj)
+			}
+		}
+		return objects
+	}
+
+	for _, obj := range rev.pdf.objects {
+		if found, err := rev.GetObject(obj.pos); err == nil && found == obj {
+			objects = append(objects, obj)
+		}
+	}
+
+	return objects
+}
+
+// Get the numbers of the objects in use at the revision, in ascending order.
+func (rev PdfRevision) numbers() []int {
+	numbers := make([]int, 0)
+	seen := make(map[int]bool)
+
+	sections := rev.pdf.sections()
+	for i := rev.number; i >= 0; i-- {
+		for number, entry := range sections[i].xref {
+			if seen[number] {
+				continue
+			}
+			seen[number] = true
+
+			if entry.InUse {
+				numbers = append(numbers, number)
+			}
+		}
+	}
+
+	sort.Ints(numbers)
+	return numbers
+}
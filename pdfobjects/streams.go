@@ -2,22 +2,19 @@ package pdfobjects
 
 import (
 	"bytes"
-	"compress/lzw"
-	"compress/zlib"
-	"encoding/ascii85"
-	"encoding/hex"
 	"errors"
-	"fmt"
-	"io"
-	"os"
 
 	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
 )
 
+// Error returned when extracting a stream without any content.
+var ErrEmptyStream = errors.New("This stream is empty.")
+
 // Wrapper for pdf stream.
 type PdfStream struct {
 	streamtype string
 	content []byte
+	loader func() ([]byte, error)
 }
 
 // Create a new `PdfStream` from byte array and streamtype.
@@ -25,84 +22,110 @@ func NewPdfStream(streamtype string, content []byte) PdfStream {
 	return PdfStream{
 		streamtype,
 		content,
+		nil,
 	}
 }
 
-// Extract the contents of a stream.
-func (s PdfStream) Extract(pobj *PdfObject, cmap *CMap) ([]byte, bool, error) {
-	// If the stream is empty, don't return anything.
-	if len(s.content) == 0 {
-		return nil, false, errors.New("This stream is empty.")
-	}
-
-	// If the stream contains an image, don't return anything.
-	// TODO: Inline OCR text extraction.
-	if pobj.IsImage() {
-		return nil, false, nil
+// Create a new `PdfStream` whose contents are read with `loader` each time
+// they are needed, so that they are not kept in memory.
+func NewLazyPdfStream(streamtype string, loader func() ([]byte, error)) PdfStream {
+	return PdfStream{
+		streamtype,
+		nil,
+		loader,
 	}
+}
 
-	// Pass the stream contents to an appropriate extraction handler.
-	switch pobj.GetEncoding() {
-	case pdftypes.ASCII85DECODE:
-		return extractASCII85(s.content, cmap)
+// Get the raw (still encoded) contents of the stream.
+// Returns nil for streams loaded on demand, see `Load`.
+func (s PdfStream) Content() []byte {
+	return s.content
+}
 
-	case pdftypes.ASCIIHEXDECODE:
-		return extractASCIIHEX(s.content, cmap)
+// Check whether the contents of the stream are loaded on demand.
+func (s PdfStream) IsLazy() bool {
+	return s.loader != nil
+}
 
-	case pdftypes.LZWDECODE:
-		return extractLZW(s.content, cmap)
+// Get the raw (still encoded) contents of the stream,
+// loading them if the stream is loaded on demand.
+func (s PdfStream) Load() ([]byte, error) {
+	if s.loader == nil {
+		return s.content, nil
+	}
+	return s.loader()
+}
 
-	case pdftypes.FLATEDECODE:
-		return extractZlib(s.content, cmap)
-		
-	default:
-		return extractStrings(s.content, cmap)
+// Load the contents of the stream and apply `filters` in order,
+// returning the decoded data.
+func (s PdfStream) Decode(filters []Filter) ([]byte, error) {
+	content, err := s.Load()
+	if err != nil {
+		return nil, err
 	}
+
+	return decodeFilters(content, filters)
 }
 
-func extractASCII85(content []byte, cmap *CMap) ([]byte, bool, error) {
-	b := bytes.NewReader(content)
+// Extract the contents of a stream.
+// Decoding errors are reported as a `PdfError` referring to `pobj`, and
+// exceeded limits of the document as one of kind `LIMIT_ERROR`.
+func (s PdfStream) Extract(pobj *PdfObject, cmap *CMap) ([]byte, bool, error) {
+	if err := pobj.limiter.CheckDeadline(); err != nil {
+		return nil, false, pdftypes.WithReference(err, pdftypes.DECODE_ERROR, pobj.Reference())
+	}
 
-	extracted, err := io.ReadAll(ascii85.NewDecoder(b))
+	// Streams loaded on demand are only kept in this copy.
+	content, err := s.Load()
 	if err != nil {
-		return nil, false, err
+		return nil, false, pdftypes.WithReference(err, pdftypes.IO_ERROR, pobj.Reference())
+	}
+	s.content, s.loader = content, nil
+
+	// If the stream is empty, don't return anything.
+	if len(s.content) == 0 {
+		return nil, false, ErrEmptyStream
 	}
-	
-	return extractStrings(extracted, cmap)
-}
 
-func extractASCIIHEX(content []byte, cmap *CMap) ([]byte, bool, error) {
-	extracted, _ := hex.DecodeString(string(content))
+	text, process, err := s.extract(pobj, cmap)
 
-	return extractStrings(extracted, cmap)
+	return text, process, pdftypes.WithReference(err, pdftypes.DECODE_ERROR, pobj.Reference())
 }
 
-func extractLZW(content []byte, cmap *CMap) ([]byte, bool, error) {
-	b := bytes.NewReader(content)
+// Decode and extract the contents of a non-empty stream.
+func (s PdfStream) extract(pobj *PdfObject, cmap *CMap) ([]byte, bool, error) {
+	// If the stream contains an image, don't return anything.
+	// TODO: Inline OCR text extraction.
+	if pobj.IsImage() {
+		return nil, false, nil
+	}
 
-	extracted, err := io.ReadAll(lzw.NewReader(b, lzw.LSB, 256))
+	filters, err := pobj.Filters()
 	if err != nil {
 		return nil, false, err
 	}
-	
-	return extractStrings(extracted, cmap)
-}
 
-// Decodes with zlib and extracts the textual contents from a stream.
-func extractZlib(content []byte, cmap *CMap) ([]byte, bool, error) {
-	b := bytes.NewReader(content)
-	
-	rc, err := zlib.NewReader(b)
-	if err != nil {
-		return nil, false, err
+	for _, filter := range filters {
+		if filter.IsImage() {
+			return nil, false, nil
+		}
 	}
-	
-	extracted, err := io.ReadAll(rc)
-	if err != nil {
+
+	// Text of partially decoded streams is still extracted.
+	decoded, err := s.Decode(filters)
+	if err != nil && !errors.Is(err, ErrPartialDecode) {
 		return nil, false, err
 	}
-	
-	return extractStrings(extracted, cmap)
+
+	if lerr := pobj.limiter.AddDecoded(len(decoded)); lerr != nil {
+		return nil, false, lerr
+	}
+
+	text, process, xerr := extractStrings(decoded, cmap)
+	if xerr != nil {
+		return nil, false, xerr
+	}
+	return text, process, err
 }
 
 // Extract in-stream text from strings
@@ -119,18 +142,35 @@ func extractStrings(content []byte, cmap *CMap) ([]byte, bool, error) {
 	in_text, in_str, in_hex := false, false, false
 	// Previous byte. 
 	var prev byte = 0
+	// Source text of the current string, its nesting depth of
+	// parentheses and whether the next byte is escaped.
+	str := make([]byte, 0)
+	depth, escaped := 0, false
 
 	// Read the stream content byte by byte
 	for b, err := reader.ReadByte(); err == nil; b, err = reader.ReadByte() {
 		if in_text {
 			if in_str { // String parsing state.
-				if b == ')' && prev != '\\' {
-					// If an unescaped ')' is encountered the string is terminated.
+				str = append(str, b)
+
+				if escaped {
+					escaped = false
+				} else if b == '\\' {
+					escaped = true
+				} else if b == '(' {
+					depth++
+				} else if b == ')' {
+					depth--
+				}
+
+				if depth == 0 {
+					// The string is terminated by its balancing ')'.
 					in_str = false
-				} else {
-					// Otherwise just parse the byte.
-					text = append(text, b)
+					text = append(text, pdftypes.PdfString(str).Bytes()...)
 				}
+
+				// Escaped bytes must not be mistaken for operators below.
+				b = 0
 			} else if in_hex { // Hexadecimal parsing state.
 				if b == '>' {
 					// If an '>' is encountered the hex value is terminated.
@@ -144,6 +184,8 @@ func extractStrings(content []byte, cmap *CMap) ([]byte, bool, error) {
 				if b == '(' {
 					// A string has begun. Start parsing it.
 					in_str = true
+					str = append(str[:0], b)
+					depth, escaped = 1, false
 				} else if b == '*' && prev == 'T' {
 					// T* is the newline token.
 					text = append(text, '\n')
@@ -173,10 +215,3 @@ func extractStrings(content []byte, cmap *CMap) ([]byte, bool, error) {
 	
 	return text, process, nil
 }
-
-func checkDecoding(err error, hex_str string) {
-	if err != nil {
-		fmt.Printf("Error - Unable to decode hexadecimal value: <%v>\n", hex_str)
-		os.Exit(-1)
-	}
-}
@@ -0,0 +1,229 @@
+package pdftypes
+
+// Follows references to the values of the objects they refer to.
+// Implemented by `pdfobjects.Pdf` and `pdfobjects.PdfRevision`.
+//
+// Streams belong to objects, so there is no `GetStream` here; use
+// `pdfobjects.GetStream` with the same resolvers instead.
+type Resolver interface {
+	Resolve(value PdfDataType) (PdfDataType, error)
+}
+
+// Get a short description of the type of `value` for error messages.
+func typeName(value PdfDataType) string {
+	switch value.(type) {
+	case PdfName:
+		return "name"
+	case PdfInteger:
+		return "integer"
+	case PdfReal:
+		return "real number"
+	case PdfString, PdfHex:
+		return "string"
+	case PdfArray:
+		return "array"
+	case PdfDict:
+		return "dictionary"
+	case PdfReference:
+		return "reference"
+	case PdfBool:
+		return "boolean"
+	case PdfNull, nil:
+		return "null"
+	default:
+		return "unknown"
+	}
+}
+
+// Resolve `value` with `resolver`, unless `resolver` is nil.
+func resolveWith(value PdfDataType, resolver Resolver) (PdfDataType, error) {
+	if resolver == nil {
+		return value, nil
+	}
+	return resolver.Resolve(value)
+}
+
+// Error for a value of type `actual` where `expected` was needed.
+func unexpectedType(expected string, actual PdfDataType) error {
+	return Errorf(SYNTAX_ERROR, -1, "%w: expected %s, got %s", ErrUnexpectedType, expected, typeName(actual))
+}
+
+// Convert `value` to a name.
+func asName(value PdfDataType) (PdfName, error) {
+	if name, ok := value.(PdfName); ok {
+		return name, nil
+	}
+	return "", unexpectedType("name", value)
+}
+
+// Convert `value` to an integer.
+func asInt(value PdfDataType) (int64, error) {
+	if number, ok := IntValue(value); ok {
+		return number, nil
+	}
+	return 0, unexpectedType("integer", value)
+}
+
+// Convert `value` to a real number.
+func asReal(value PdfDataType) (float64, error) {
+	if number, ok := RealValue(value); ok {
+		return number, nil
+	}
+	return 0, unexpectedType("number", value)
+}
+
+// Convert `value` to a dictionary.
+func asDict(value PdfDataType) (PdfDict, error) {
+	if dict, ok := value.(PdfDict); ok {
+		return dict, nil
+	}
+	return nil, unexpectedType("dictionary", value)
+}
+
+// Convert `value` to an array.
+func asArray(value PdfDataType) (PdfArray, error) {
+	if array, ok := value.(PdfArray); ok {
+		return array, nil
+	}
+	return nil, unexpectedType("array", value)
+}
+
+// Convert `value`, a literal or hexadecimal string, to its bytes.
+func asString(value PdfDataType) ([]byte, error) {
+	switch str := value.(type) {
+	case PdfString:
+		return str.Bytes(), nil
+	case PdfHex:
+		return str.Decode()
+	}
+	return nil, unexpectedType("string", value)
+}
+
+// Look up `key` and resolve the value with `resolver`, if not nil.
+func (d PdfDict) lookup(key PdfName, resolver Resolver) (PdfDataType, error) {
+	value, ok := d.Get(key)
+	if !ok {
+		return nil, Errorf(REFERENCE_ERROR, -1, "%w: %s", ErrKeyNotFound, key)
+	}
+
+	return resolveWith(value, resolver)
+}
+
+// Get the name stored at `key`.
+// References are followed if `resolver` is not nil, also for the other accessors.
+func (d PdfDict) GetName(key PdfName, resolver Resolver) (PdfName, error) {
+	value, err := d.lookup(key, resolver)
+	if err != nil {
+		return "", err
+	}
+	return asName(value)
+}
+
+// Get the integer stored at `key`.
+func (d PdfDict) GetInt(key PdfName, resolver Resolver) (int64, error) {
+	value, err := d.lookup(key, resolver)
+	if err != nil {
+		return 0, err
+	}
+	return asInt(value)
+}
+
+// Get the number stored at `key`. Integers are converted to real numbers.
+func (d PdfDict) GetReal(key PdfName, resolver Resolver) (float64, error) {
+	value, err := d.lookup(key, resolver)
+	if err != nil {
+		return 0, err
+	}
+	return asReal(value)
+}
+
+// Get the dictionary stored at `key`.
+func (d PdfDict) GetDict(key PdfName, resolver Resolver) (PdfDict, error) {
+	value, err := d.lookup(key, resolver)
+	if err != nil {
+		return nil, err
+	}
+	return asDict(value)
+}
+
+// Get the array stored at `key`.
+func (d PdfDict) GetArray(key PdfName, resolver Resolver) (PdfArray, error) {
+	value, err := d.lookup(key, resolver)
+	if err != nil {
+		return nil, err
+	}
+	return asArray(value)
+}
+
+// Get the bytes of the literal or hexadecimal string stored at `key`.
+func (d PdfDict) GetString(key PdfName, resolver Resolver) ([]byte, error) {
+	value, err := d.lookup(key, resolver)
+	if err != nil {
+		return nil, err
+	}
+	return asString(value)
+}
+
+// Get the element at index `i` and resolve it with `resolver`, if not nil.
+func (a PdfArray) lookup(i int, resolver Resolver) (PdfDataType, error) {
+	if i < 0 || i >= len(a) {
+		return nil, Errorf(REFERENCE_ERROR, -1, "%w: %d of %d", ErrIndexOutOfRange, i, len(a))
+	}
+
+	return resolveWith(a[i], resolver)
+}
+
+// Get the name at index `i`.
+// References are followed if `resolver` is not nil, also for the other accessors.
+func (a PdfArray) GetName(i int, resolver Resolver) (PdfName, error) {
+	value, err := a.lookup(i, resolver)
+	if err != nil {
+		return "", err
+	}
+	return asName(value)
+}
+
+// Get the integer at index `i`.
+func (a PdfArray) GetInt(i int, resolver Resolver) (int64, error) {
+	value, err := a.lookup(i, resolver)
+	if err != nil {
+		return 0, err
+	}
+	return asInt(value)
+}
+
+// Get the number at index `i`. Integers are converted to real numbers.
+func (a PdfArray) GetReal(i int, resolver Resolver) (float64, error) {
+	value, err := a.lookup(i, resolver)
+	if err != nil {
+		return 0, err
+	}
+	return asReal(value)
+}
+
+// Get the dictionary at index `i`.
+func (a PdfArray) GetDict(i int, resolver Resolver) (PdfDict, error) {
+	value, err := a.lookup(i, resolver)
+	if err != nil {
+		return nil, err
+	}
+	return asDict(value)
+}
+
+// Get the array at index `i`.
+func (a PdfArray) GetArray(i int, resolver Resolver) (PdfArray, error) {
+	value, err := a.lookup(i, resolver)
+	if err != nil {
+		return nil, err
+	}
+	return asArray(value)
+}
+
+// Get the bytes of the literal or hexadecimal string at index `i`.
+func (a PdfArray) GetString(i int, resolver Resolver) ([]byte, error) {
+	value, err := a.lookup(i, resolver)
+	if err != nil {
+		return nil, err
+	}
+	return asString(value)
+}
@@ -0,0 +1,163 @@
+package pdftypes
+
+import (
+	"errors"
+	"testing"
+)
+
+// Resolves references from a map, as `pdfobjects.Pdf` does from its index.
+type mapResolver map[PdfReference]PdfDataType
+
+func (r mapResolver) Resolve(value PdfDataType) (PdfDataType, error) {
+	for {
+		ref, ok := value.(PdfReference)
+		if !ok {
+			return value, nil
+		}
+		if value, ok = r[ref]; !ok {
+			return nil, Errorf(REFERENCE_ERROR, -1, "Object %v not found.", ref)
+		}
+	}
+}
+
+var (
+	NAME_KEY = NewPdfName("/Name")
+	INT_KEY = NewPdfName("/Int")
+	REAL_KEY = NewPdfName("/Real")
+	DICT_KEY = NewPdfName("/Dict")
+	ARRAY_KEY = NewPdfName("/Array")
+	STRING_KEY = NewPdfName("/String")
+	REF_KEY = NewPdfName("/Ref")
+	MISSING_KEY = NewPdfName("/Missing")
+)
+
+func accessorSample() (PdfDict, mapResolver) {
+	dict := PdfDict{
+		NAME_KEY: NewPdfName("/Catalog"),
+		INT_KEY: PdfInteger(42),
+		REAL_KEY: PdfReal(1.5),
+		DICT_KEY: PdfDict{INT_KEY: PdfInteger(1)},
+		ARRAY_KEY: PdfArray{PdfInteger(1), PdfReal(2)},
+		STRING_KEY: PdfString("(Hello)"),
+		REF_KEY: PdfReference{Object: 1},
+	}
+	resolver := mapResolver{
+		PdfReference{Object: 1}: PdfReference{Object: 2},
+		PdfReference{Object: 2}: PdfInteger(7),
+	}
+	return dict, resolver
+}
+
+func TestPdfDictAccessors(t *testing.T) {
+	dict, resolver := accessorSample()
+
+	if name, err := dict.GetName(NAME_KEY, nil); err != nil || name != NewPdfName("/Catalog") {
+		t.Errorf("GetName: got %v, %v", name, err)
+	}
+	if number, err := dict.GetInt(INT_KEY, nil); err != nil || number != 42 {
+		t.Errorf("GetInt: got %v, %v", number, err)
+	}
+	if number, err := dict.GetReal(REAL_KEY, nil); err != nil || number != 1.5 {
+		t.Errorf("GetReal: got %v, %v", number, err)
+	}
+	// Integers are also real numbers, and whole real numbers integers.
+	if number, err := dict.GetReal(INT_KEY, nil); err != nil || number != 42 {
+		t.Errorf("GetReal of integer: got %v, %v", number, err)
+	}
+	if number, err := dict.GetArray(ARRAY_KEY, nil); err != nil || len(number) != 2 {
+		t.Errorf("GetArray: got %v, %v", number, err)
+	}
+	if sub, err := dict.GetDict(DICT_KEY, nil); err != nil || len(sub) != 1 {
+		t.Errorf("GetDict: got %v, %v", sub, err)
+	}
+	if data, err := dict.GetString(STRING_KEY, nil); err != nil || string(data) != "Hello" {
+		t.Errorf("GetString: got %q, %v", data, err)
+	}
+
+	// References are followed, also through other references.
+	if number, err := dict.GetInt(REF_KEY, resolver); err != nil || number != 7 {
+		t.Errorf("GetInt with resolver: got %v, %v", number, err)
+	}
+}
+
+func TestPdfDictAccessorErrors(t *testing.T) {
+	dict, resolver := accessorSample()
+
+	tests := []struct {
+		name string
+		err error
+		expected error
+	}{
+		{"missing key", second(dict.GetInt(MISSING_KEY, nil)), ErrKeyNotFound},
+		{"name as integer", second(dict.GetInt(NAME_KEY, nil)), ErrUnexpectedType},
+		{"real as integer", second(dict.GetInt(REAL_KEY, nil)), ErrUnexpectedType},
+		{"integer as name", second(dict.GetName(INT_KEY, nil)), ErrUnexpectedType},
+		{"array as dictionary", second(dict.GetDict(ARRAY_KEY, nil)), ErrUnexpectedType},
+		{"dictionary as array", second(dict.GetArray(DICT_KEY, nil)), ErrUnexpectedType},
+		{"name as string", second(dict.GetString(NAME_KEY, nil)), ErrUnexpectedType},
+		// Without a resolver, references are not followed.
+		{"unresolved reference", second(dict.GetInt(REF_KEY, nil)), ErrUnexpectedType},
+		{"resolved to integer", second(dict.GetName(REF_KEY, resolver)), ErrUnexpectedType},
+	}
+
+	for _, test := range tests {
+		var pdf_err *PdfError
+		if !errors.Is(test.err, test.expected) || !errors.As(test.err, &pdf_err) {
+			t.Errorf("%s: got %v, expected %v", test.name, test.err, test.expected)
+		}
+	}
+
+	missing := PdfDict{REF_KEY: PdfReference{Object: 3}}
+	if _, err := missing.GetInt(REF_KEY, resolver); err == nil {
+		t.Errorf("Expected an error for a reference that cannot be resolved")
+	}
+}
+
+func TestPdfArrayAccessors(t *testing.T) {
+	array := PdfArray{
+		NewPdfName("/Catalog"),
+		PdfInteger(42),
+		PdfReal(1.5),
+		PdfDict{},
+		PdfArray{},
+		PdfHex("4869"),
+		PdfReference{Object: 1},
+	}
+	resolver := mapResolver{PdfReference{Object: 1}: PdfInteger(7)}
+
+	if name, err := array.GetName(0, nil); err != nil || name != NewPdfName("/Catalog") {
+		t.Errorf("GetName: got %v, %v", name, err)
+	}
+	if number, err := array.GetInt(1, nil); err != nil || number != 42 {
+		t.Errorf("GetInt: got %v, %v", number, err)
+	}
+	if number, err := array.GetReal(2, nil); err != nil || number != 1.5 {
+		t.Errorf("GetReal: got %v, %v", number, err)
+	}
+	if _, err := array.GetDict(3, nil); err != nil {
+		t.Errorf("GetDict: %v", err)
+	}
+	if _, err := array.GetArray(4, nil); err != nil {
+		t.Errorf("GetArray: %v", err)
+	}
+	if data, err := array.GetString(5, nil); err != nil || string(data) != "Hi" {
+		t.Errorf("GetString: got %q, %v", data, err)
+	}
+	if number, err := array.GetInt(6, resolver); err != nil || number != 7 {
+		t.Errorf("GetInt with resolver: got %v, %v", number, err)
+	}
+
+	for _, i := range []int{-1, len(array)} {
+		if _, err := array.GetInt(i, nil); !errors.Is(err, ErrIndexOutOfRange) {
+			t.Errorf("Index %d: got %v, expected %v", i, err, ErrIndexOutOfRange)
+		}
+	}
+	if _, err := array.GetDict(0, nil); !errors.Is(err, ErrUnexpectedType) {
+		t.Errorf("Name as dictionary: got %v, expected %v", err, ErrUnexpectedType)
+	}
+}
+
+// Get the error of an accessor call.
+func second[T any](_ T, err error) error {
+	return err
+}
@@ -0,0 +1,135 @@
+package pdftypes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Kind of error encountered while reading a pdf file.
+type ErrorKind int
+
+const (
+	// Reading from the underlying file failed.
+	IO_ERROR ErrorKind = iota
+	// The file does not follow the pdf syntax.
+	SYNTAX_ERROR
+	// The cross-reference table or trailer is missing or broken.
+	XREF_ERROR
+	// A referenced object does not exist or references form a cycle.
+	REFERENCE_ERROR
+	// The contents of a stream could not be decoded.
+	DECODE_ERROR
+	// The file is encrypted in a way that is not supported.
+	ENCRYPTION_ERROR
+	// The file is encrypted and the password does not open it.
+	PASSWORD_ERROR
+	// Reading the file would exceed a configured limit.
+	LIMIT_ERROR
+)
+
+// Wrapped by errors of kind `PASSWORD_ERROR`.
+var ErrPasswordRequired = errors.New("Document is encrypted, password required")
+
+// Wrapped by errors of kind `LIMIT_ERROR`.
+var ErrLimitExceeded = errors.New("Limit exceeded")
+
+// Wrapped by errors of the typed accessors of `PdfDict` and `PdfArray`.
+var (
+	ErrKeyNotFound = errors.New("Key not found")
+	ErrIndexOutOfRange = errors.New("Index out of range")
+	ErrUnexpectedType = errors.New("Unexpected type")
+)
+
+// Stringer implementation for ErrorKind.
+func (k ErrorKind) String() string {
+	switch k {
+	case IO_ERROR:
+		return "IOError"
+	case SYNTAX_ERROR:
+		return "SyntaxError"
+	case XREF_ERROR:
+		return "XrefError"
+	case REFERENCE_ERROR:
+		return "ReferenceError"
+	case DECODE_ERROR:
+		return "DecodeError"
+	case ENCRYPTION_ERROR:
+		return "EncryptionError"
+	case PASSWORD_ERROR:
+		return "PasswordError"
+	case LIMIT_ERROR:
+		return "LimitError"
+	default:
+		return "Error"
+	}
+}
+
+// Error encountered while reading or processing a pdf file.
+//
+// `Offset` is the byte offset in the file where the error occurred, or -1 if
+// it is unknown. `Ref` is the object being read, or the zero reference if the
+// error did not occur within an object.
+type PdfError struct {
+	Kind ErrorKind
+	Offset int64
+	Ref PdfReference
+	Err error
+}
+
+// Create a new `PdfError` of kind `kind` wrapping `err`.
+func NewPdfError(kind ErrorKind, offset int64, err error) *PdfError {
+	return &PdfError{
+		kind,
+		offset,
+		PdfReference{},
+		err,
+	}
+}
+
+// Create a new `PdfError` of kind `kind` with a formatted message.
+func Errorf(kind ErrorKind, offset int64, format string, args ...interface{}) *PdfError {
+	return NewPdfError(kind, offset, fmt.Errorf(format, args...))
+}
+
+// Implementation of the error interface for PdfError.
+func (e *PdfError) Error() string {
+	var builder strings.Builder
+	builder.WriteString(e.Kind.String())
+
+	if e.Offset >= 0 {
+		fmt.Fprintf(&builder, " at offset %d", e.Offset)
+	}
+
+	if e.Ref != (PdfReference{}) {
+		fmt.Fprintf(&builder, " in object %v", e.Ref)
+	}
+
+	fmt.Fprintf(&builder, ": %v", e.Err)
+
+	return builder.String()
+}
+
+// Return the wrapped error.
+func (e *PdfError) Unwrap() error {
+	return e.Err
+}
+
+// Attach the reference `ref` to `err` if it is a `PdfError` without one.
+// Other errors are wrapped in a `PdfError` of kind `kind`.
+func WithReference(err error, kind ErrorKind, ref PdfReference) error {
+	if err == nil {
+		return nil
+	}
+
+	pdf_err, ok := err.(*PdfError)
+	if !ok {
+		pdf_err = NewPdfError(kind, -1, err)
+	}
+
+	if pdf_err.Ref == (PdfReference{}) {
+		pdf_err.Ref = ref
+	}
+
+	return pdf_err
+}
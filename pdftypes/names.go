@@ -5,8 +5,62 @@ const (
 	OBJ_TYPE PdfName = "/Type"
 	XOBJECT PdfName = "/XObject"
 	OBJSTM PdfName = "/ObjStm"
+	XREFSTREAM PdfName = "/XRef"
 	PAGE PdfName = "/Page"
 	PAGES PdfName = "/Pages"
+	CATALOG PdfName = "/Catalog"
+
+	// Linearization dictionary key
+	LINEARIZED PdfName = "/Linearized"
+
+	// Trailer keys
+	ROOT PdfName = "/Root"
+	INFO PdfName = "/Info"
+	ID PdfName = "/ID"
+	SIZE PdfName = "/Size"
+	PREV PdfName = "/Prev"
+	XREFSTM PdfName = "/XRefStm"
+	ENCRYPT PdfName = "/Encrypt"
+
+	// Cross-reference stream keys
+	W PdfName = "/W"
+	INDEX PdfName = "/Index"
+
+	// Object stream keys
+	N PdfName = "/N"
+	FIRST PdfName = "/First"
+
+	// Stream keys
+	LENGTH PdfName = "/Length"
+	DECODEPARMS PdfName = "/DecodeParms"
+	PREDICTOR PdfName = "/Predictor"
+	COLUMNS PdfName = "/Columns"
+	COLORS PdfName = "/Colors"
+	BITSPERCOMPONENT PdfName = "/BitsPerComponent"
+	EARLYCHANGE PdfName = "/EarlyChange"
+
+	// Encryption dictionary keys
+	STANDARD PdfName = "/Standard"
+	V PdfName = "/V"
+	R PdfName = "/R"
+	O PdfName = "/O"
+	U PdfName = "/U"
+	OE PdfName = "/OE"
+	UE PdfName = "/UE"
+	P PdfName = "/P"
+	CF PdfName = "/CF"
+	CFM PdfName = "/CFM"
+	STMF PdfName = "/StmF"
+	STRF PdfName = "/StrF"
+	ENCRYPTMETADATA PdfName = "/EncryptMetadata"
+	METADATA PdfName = "/Metadata"
+
+	// Crypt filter methods
+	IDENTITY PdfName = "/Identity"
+	NONE PdfName = "/None"
+	V2 PdfName = "/V2"
+	AESV2 PdfName = "/AESV2"
+	AESV3 PdfName = "/AESV3"
 
 	// Compression specifier
 	FILTER PdfName = "/Filter"
@@ -21,4 +75,26 @@ const (
 	JBIG2DECODE PdfName = "/JBIG2Decode"
 	DCTDECODE PdfName = "/DCTDecode"
 	JPXDECODE PdfName = "/JPXDecode"
+	CRYPT PdfName = "/Crypt"
+
+	// Abbreviated compression methods, used by inline images
+	AHX PdfName = "/AHx"
+	A85 PdfName = "/A85"
+	LZW PdfName = "/LZW"
+	FL PdfName = "/Fl"
+	RL PdfName = "/RL"
+	CCF PdfName = "/CCF"
+	DCT PdfName = "/DCT"
+
+	// Crypt filter parameters
+	NAME PdfName = "/Name"
+
+	// CCITT fax filter parameters
+	K PdfName = "/K"
+	ROWS PdfName = "/Rows"
+	BLACKIS1 PdfName = "/BlackIs1"
+	ENCODEDBYTEALIGN PdfName = "/EncodedByteAlign"
+
+	// Image keys
+	HEIGHT PdfName = "/Height"
 )
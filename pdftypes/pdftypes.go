@@ -26,6 +26,8 @@ const (
 
 	// PdfName begin token
 	NAME_BEGIN = "/"
+	// PdfName escape character, followed by two hexadecimal digits
+	NAME_ESCAPE = "#"
 
 	// PdfReference end token
 	REFERENCE_END = "R"
@@ -54,6 +56,13 @@ const (
 
 	// Pdf version prefix token
 	PDF_VERSION = "%PDF-"
+
+	// Cross-reference table begin token
+	XREF = "xref"
+	// Trailer begin token
+	TRAILER = "trailer"
+	// Cross-reference offset token
+	STARTXREF = "startxref"
 )
 
 // Check whether the Array begin token appears at the beginning of the line.
@@ -167,17 +176,208 @@ type PdfDataType interface{
 }
 
 // Pdf Name (Symbol/Atom) data type.
+//
+// Holds the name with `#xx` escape sequences decoded, so that names compare
+// equal to the constants in names.go however they were written.
 type PdfName string
 func (n PdfName) noOp() {}
 
-// Pdf number data type.
-type PdfNumber float32
-func (n PdfNumber) noOp() {}
+// Create a name from its source text, decoding `#xx` escape sequences.
+// A `#` not followed by two hexadecimal digits is kept as it is.
+func NewPdfName(raw string) PdfName {
+	if !strings.Contains(raw, NAME_ESCAPE) {
+		return PdfName(raw)
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == NAME_ESCAPE[0] && i+2 < len(raw) {
+			if b, err := hex.DecodeString(raw[i+1 : i+3]); err == nil {
+				builder.WriteByte(b[0])
+				i += 2
+				continue
+			}
+		}
+		builder.WriteByte(raw[i])
+	}
+
+	return PdfName(builder.String())
+}
+
+// Get the name as pdf source text, escaping characters that cannot appear
+// in a name verbatim as `#xx`. This is a canonical form, not necessarily the
+// way the name was written in the file, as other characters may be escaped
+// there too: `/Flate#44ecode` gives `/FlateDecode`. The source text of names
+// read from a file is kept by their object, see `PdfObject.RawName`.
+func (n PdfName) Escaped() string {
+	var builder strings.Builder
+	builder.WriteString(NAME_BEGIN)
+
+	for i := len(NAME_BEGIN); i < len(n); i++ {
+		b := n[i]
+		if b < 0x21 || b > 0x7E || b == '#' || strings.IndexByte("()<>[]{}/%", b) >= 0 {
+			fmt.Fprintf(&builder, "#%02X", b)
+		} else {
+			builder.WriteByte(b)
+		}
+	}
+
+	return builder.String()
+}
+
+// Pdf number data type, either a `PdfInteger` or a `PdfReal`.
+type PdfNumber interface {
+	PdfDataType
+	Int() int64
+	Float() float64
+}
+
+// Pdf integer data type.
+type PdfInteger int64
+func (i PdfInteger) noOp() {}
+
+// Get the value of the integer.
+func (i PdfInteger) Int() int64 {
+	return int64(i)
+}
+
+// Get the value of the integer as a real number.
+func (i PdfInteger) Float() float64 {
+	return float64(i)
+}
+
+// Pdf real number data type.
+type PdfReal float64
+func (r PdfReal) noOp() {}
+
+// Get the value of the real number truncated to an integer.
+func (r PdfReal) Int() int64 {
+	return int64(r)
+}
+
+// Get the value of the real number.
+func (r PdfReal) Float() float64 {
+	return float64(r)
+}
+
+// Get the value of `value` as an integer. Real numbers are only accepted
+// if they have no fractional part, as some writers use them for lengths.
+func IntValue(value PdfDataType) (int64, bool) {
+	switch number := value.(type) {
+	case PdfInteger:
+		return int64(number), true
+	case PdfReal:
+		if number == PdfReal(int64(number)) {
+			return int64(number), true
+		}
+	}
+	return 0, false
+}
+
+// Get the value of `value` as a real number. Integers are converted.
+func RealValue(value PdfDataType) (float64, bool) {
+	if number, ok := value.(PdfNumber); ok {
+		return number.Float(), true
+	}
+	return 0, false
+}
 
 // Pdf string data type.
+//
+// Holds the source text of a literal string, including the parentheses.
+// Use `Bytes` or `Text` to get the string with escape sequences resolved.
 type PdfString string
 func (s PdfString) noOp() {}
 
+// Get the source text of the string, including the parentheses.
+func (s PdfString) Raw() string {
+	return string(s)
+}
+
+// Get the string as a text string, with escape sequences resolved and
+// decoded from PDFDocEncoding or UTF-16BE.
+func (s PdfString) Text() string {
+	return DecodeTextString(s.Bytes())
+}
+
+// Create a literal string holding `data`, escaping characters as needed.
+func NewPdfString(data []byte) PdfString {
+	var builder strings.Builder
+	builder.WriteByte('(')
+
+	for _, b := range data {
+		switch b {
+		case '(', ')', '\\':
+			builder.WriteByte('\\')
+			builder.WriteByte(b)
+		case '\r':
+			builder.WriteString("\\r")
+		default:
+			builder.WriteByte(b)
+		}
+	}
+
+	builder.WriteByte(')')
+	return PdfString(builder.String())
+}
+
+// Get the bytes of the string with escape sequences resolved.
+func (s PdfString) Bytes() []byte {
+	raw := strings.TrimSuffix(strings.TrimPrefix(string(s), STRING_BEGIN), STRING_END)
+	data := make([]byte, 0, len(raw))
+
+	for i := 0; i < len(raw); i++ {
+		b := raw[i]
+
+		// End-of-line markers are read as a single line feed.
+		if b == '\r' {
+			if i+1 < len(raw) && raw[i+1] == '\n' {
+				i++
+			}
+			data = append(data, '\n')
+			continue
+		}
+
+		if b != '\\' || i+1 == len(raw) {
+			data = append(data, b)
+			continue
+		}
+
+		i++
+		switch c := raw[i]; c {
+		case 'n':
+			data = append(data, '\n')
+		case 'r':
+			data = append(data, '\r')
+		case 't':
+			data = append(data, '\t')
+		case 'b':
+			data = append(data, '\b')
+		case 'f':
+			data = append(data, '\f')
+		case '\r':
+			// A backslash at the end of a line continues the string.
+			if i+1 < len(raw) && raw[i+1] == '\n' {
+				i++
+			}
+		case '\n':
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			// Up to three octal digits, high-order overflow is ignored.
+			value := 0
+			for n := 0; n < 3 && i < len(raw) && raw[i] >= '0' && raw[i] <= '7'; n++ {
+				value = value*8 + int(raw[i]-'0')
+				i++
+			}
+			i--
+			data = append(data, byte(value))
+		default:
+			data = append(data, c)
+		}
+	}
+
+	return data
+}
+
 // Pdf reference data type.
 type PdfReference struct {
 	Object int
@@ -198,6 +398,20 @@ func (a PdfArray) noOp() {}
 type PdfDict map[PdfDataType]PdfDataType
 func (d PdfDict) noOp() {}
 
+// Look up the entry with the key `key`. Keys are stored as decoded names,
+// so the entry written `/Flate#44ecode` is found with `/FlateDecode`.
+// `key` must be decoded already, as it is not decoded again.
+func (d PdfDict) Get(key PdfName) (PdfDataType, bool) {
+	value, ok := d[key]
+	return value, ok
+}
+
+// Look up the entry with the key written as `raw` in pdf source text,
+// decoding its `#xx` escape sequences first.
+func (d PdfDict) GetRaw(raw string) (PdfDataType, bool) {
+	return d.Get(NewPdfName(raw))
+}
+
 // Pdf null type
 type PdfNull bool
 func (n PdfNull) noOp() {}
@@ -206,11 +420,46 @@ func (n PdfNull) noOp() {}
 type PdfBool bool
 func (b PdfBool) noOp() {}
 
+// White-space characters, ignored in hexadecimal strings.
+const HEX_WHITESPACE = "\x00\t\n\f\r "
+
 // Pdf hexadecimal data type.
 type PdfHex string
 func (h PdfHex) noOp() {}
 
-// Decode the hexadecimal value.
+// Decode the hexadecimal value as specified for hexadecimal strings:
+// white-space is ignored and a final odd digit is followed by 0.
+// Any other character that is not a hexadecimal digit is an error.
 func (h PdfHex) Decode() ([]byte, error) {
-	return hex.DecodeString(string(h))
+	return h.decode(false)
+}
+
+// Get the value as a text string. A final odd digit is followed by 0
+// and invalid digits are ignored.
+func (h PdfHex) Text() string {
+	data, _ := h.decode(true)
+	return DecodeTextString(data)
+}
+
+// Decode the digits of the value, ignoring white-space, and with `tolerant`
+// any other character that is not a digit.
+func (h PdfHex) decode(tolerant bool) ([]byte, error) {
+	digits := make([]byte, 0, len(h)+1)
+	for i := 0; i < len(h); i++ {
+		switch c := h[i]; {
+		case c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F':
+			digits = append(digits, c)
+		case tolerant || strings.IndexByte(HEX_WHITESPACE, c) >= 0:
+		default:
+			return nil, Errorf(DECODE_ERROR, -1, "Invalid hexadecimal digit %q", c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	data := make([]byte, len(digits)/2)
+	hex.Decode(data, digits)
+
+	return data, nil
 }
@@ -0,0 +1,122 @@
+package pdftypes
+
+import (
+	"testing"
+)
+
+func TestNewPdfName(t *testing.T) {
+	tests := []struct {
+		raw string
+		name PdfName
+		escaped string
+	}{
+		{"/FlateDecode", FLATEDECODE, "/FlateDecode"},
+		{"/Flate#44ecode", FLATEDECODE, "/FlateDecode"},
+		{"/Font#20Name", "/Font Name", "/Font#20Name"},
+		{"/A#2f#2F", "/A//", "/A#2F#2F"},
+		{"/Bad#4", "/Bad#4", "/Bad#234"},
+		{"/Bad#zz", "/Bad#zz", "/Bad#23zz"},
+	}
+
+	for _, test := range tests {
+		name := NewPdfName(test.raw)
+		if name != test.name {
+			t.Errorf("%s: got %q, expected %q", test.raw, name, test.name)
+		}
+		if escaped := name.Escaped(); escaped != test.escaped {
+			t.Errorf("%s: escaped as %q, expected %q", test.raw, escaped, test.escaped)
+		}
+	}
+}
+
+// Lookups use the decoded name, however the key was written.
+func TestPdfDictGet(t *testing.T) {
+	dict := PdfDict{NewPdfName("/Fil#74er"): FLATEDECODE}
+
+	if value, ok := dict.Get(FILTER); !ok || value != FLATEDECODE {
+		t.Errorf("Get: %v, %v", value, ok)
+	}
+	if value, ok := dict.GetRaw("/F#69lter"); !ok || value != FLATEDECODE {
+		t.Errorf("GetRaw: %v, %v", value, ok)
+	}
+}
+
+func TestPdfHexDecode(t *testing.T) {
+	tests := []struct {
+		hex PdfHex
+		expected string
+	}{
+		{"", ""},
+		{"48656C6c6F", "Hello"},
+		{"48 65\n6C\r\n6c\t6F", "Hello"},
+		{"901FA", "\x90\x1f\xa0"},
+		{"901fa3", "\x90\x1f\xa3"},
+		{"7", "\x70"},
+	}
+
+	for _, test := range tests {
+		data, err := test.hex.Decode()
+		if err != nil || string(data) != test.expected {
+			t.Errorf("%q: got %q, %v, expected %q", test.hex, data, err, test.expected)
+		}
+	}
+
+	for _, invalid := range []PdfHex{"4G", "48-65", "<48>"} {
+		if data, err := invalid.Decode(); err == nil {
+			t.Errorf("%q: expected an error, got %q", invalid, data)
+		}
+	}
+}
+
+// Hexadecimal strings are read by the typed accessors by the same rules.
+func TestGetStringHex(t *testing.T) {
+	dict := PdfDict{NewPdfName("/Title"): PdfHex("48 65 6C 6C 6F 2")}
+
+	data, err := dict.GetString(NewPdfName("/Title"), nil)
+	if err != nil || string(data) != "Hello " {
+		t.Errorf("Got %q, %v", data, err)
+	}
+}
+
+func TestPdfStringBytes(t *testing.T) {
+	tests := []struct {
+		name string
+		str PdfString
+		expected string
+	}{
+		{"empty", "()", ""},
+		{"plain", "(Hello)", "Hello"},
+		{"balanced parentheses", "(a (b) c)", "a (b) c"},
+		{"escapes", `(\n\r\t\b\f\(\)\\)`, "\n\r\t\b\f()\\"},
+		{"unknown escape", `(\q)`, "q"},
+		{"octal", `(\101\102)`, "AB"},
+		{"short octal", `(\0\12x)`, "\x00\nx"},
+		{"octal followed by digit", `(\1014)`, "A4"},
+		{"octal followed by 8", `(\18)`, "\x018"},
+		{"octal overflow", `(\501)`, "A"},
+		{"continuation LF", "(ab\\\ncd)", "abcd"},
+		{"continuation CR", "(ab\\\rcd)", "abcd"},
+		{"continuation CRLF", "(ab\\\r\ncd)", "abcd"},
+		{"LF", "(a\nb)", "a\nb"},
+		{"CR", "(a\rb)", "a\nb"},
+		{"CRLF", "(a\r\nb)", "a\nb"},
+		{"CR CR", "(a\r\rb)", "a\n\nb"},
+		{"escaped CR", `(a\rb)`, "a\rb"},
+		{"trailing backslash", `(a\)`, "a\\"},
+	}
+
+	for _, test := range tests {
+		if data := test.str.Bytes(); string(data) != test.expected {
+			t.Errorf("%s: %q gave %q, expected %q", test.name, test.str, data, test.expected)
+		}
+	}
+}
+
+// Strings created with `NewPdfString` give back the same bytes.
+func TestNewPdfString(t *testing.T) {
+	for _, data := range []string{"", "Hello", "a(b", "a)b", "a\\b", "a\rb", "a\r\nb", "\x00\xff"} {
+		if str := NewPdfString([]byte(data)); string(str.Bytes()) != data {
+			t.Errorf("%q: %q gave %q", data, str, str.Bytes())
+		}
+	}
+}
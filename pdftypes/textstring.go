@@ -0,0 +1,81 @@
+package pdftypes
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// Characters of PDFDocEncoding that differ from ISO Latin-1.
+// Codes without a character are mapped to the replacement character.
+var pdfDocEncoding = map[byte]rune{
+	0x18: '˘', 0x19: 'ˇ', 0x1A: 'ˆ', 0x1B: '˙',
+	0x1C: '˝', 0x1D: '˛', 0x1E: '˚', 0x1F: '˜',
+	0x7F: '�',
+	0x80: '•', 0x81: '†', 0x82: '‡', 0x83: '…',
+	0x84: '—', 0x85: '–', 0x86: 'ƒ', 0x87: '⁄',
+	0x88: '‹', 0x89: '›', 0x8A: '−', 0x8B: '‰',
+	0x8C: '„', 0x8D: '“', 0x8E: '”', 0x8F: '‘',
+	0x90: '’', 0x91: '‚', 0x92: '™', 0x93: 'ﬁ',
+	0x94: 'ﬂ', 0x95: 'Ł', 0x96: 'Œ', 0x97: 'Š',
+	0x98: 'Ÿ', 0x99: 'Ž', 0x9A: 'ı', 0x9B: 'ł',
+	0x9C: 'œ', 0x9D: 'š', 0x9E: 'ž', 0x9F: '�',
+	0xA0: '€', 0xAD: '�',
+}
+
+// Decode a text string, as used outside content streams for metadata,
+// annotations, bookmarks and form fields, into UTF-8.
+//
+// Text strings starting with a byte order mark are UTF-16BE, or UTF-8 since
+// PDF 2.0. Other text strings are PDFDocEncoding.
+func DecodeTextString(data []byte) string {
+	switch {
+	case len(data) >= 2 && data[0] == 0xFE && data[1] == 0xFF:
+		return decodeUTF16(data[2:])
+	case len(data) >= 3 && data[0] == 0xEF && data[1] == 0xBB && data[2] == 0xBF:
+		return strings.ToValidUTF8(string(data[3:]), "�")
+	}
+
+	var builder strings.Builder
+	for _, b := range data {
+		if r, ok := pdfDocEncoding[b]; ok {
+			builder.WriteRune(r)
+		} else {
+			builder.WriteRune(rune(b))
+		}
+	}
+
+	return builder.String()
+}
+
+// Decode UTF-16BE text. Language tags enclosed in ESC (U+001B)
+// characters are left out, and a trailing odd byte is ignored.
+func decodeUTF16(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+	}
+
+	var builder strings.Builder
+	in_tag := false
+
+	for _, r := range utf16.Decode(units) {
+		if r == 0x1B {
+			in_tag = !in_tag
+		} else if !in_tag {
+			builder.WriteRune(r)
+		}
+	}
+
+	return builder.String()
+}
+
+// Get the text of `value` if it is a literal or hexadecimal string.
+func TextString(value PdfDataType) (string, bool) {
+	switch str := value.(type) {
+	case PdfString:
+		return str.Text(), true
+	case PdfHex:
+		return str.Text(), true
+	}
+	return "", false
+}
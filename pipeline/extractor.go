@@ -1,8 +1,8 @@
 package pipeline
 
 import (
+	"errors"
 	"fmt"
-	"sync"
 
 	"git.magenta.dk/os2datascanner/pdfanalyzer/pdfobjects"
 )
@@ -16,17 +16,22 @@ func runExtractorStage(
 	in <-chan pdfobjects.PdfObject,
 	out chan<- ExtractorResult,
 	cmap *pdfobjects.CMap,
-	wg *sync.WaitGroup,
 ) {
 	f(in, out, cmap)
-	wg.Done()
 }
 
 // Simple extractor function that extracts text and cmaps.
 func SimpleExtractor(in <-chan pdfobjects.PdfObject, out chan<- ExtractorResult, cmap *pdfobjects.CMap) {
 	defer close(out)
 	for data := range in {
-		out <- NewExtractorResult(data.ExtractStream(cmap))
+		// The text of partially decoded streams is kept, but marked.
+		stream, process, err := data.ExtractStream(cmap)
+		partial := errors.Is(err, pdfobjects.ErrPartialDecode)
+		if partial {
+			err = nil
+		}
+
+		out <- NewExtractorResult(stream, process, err).WithOrigin(NewOrigin(data)).WithPartial(partial)
 	}
 }
 
@@ -34,6 +39,8 @@ type ExtractorResult struct {
 	stream string
 	process bool
 	err error
+	origin Origin
+	partial bool
 }
 
 func NewExtractorResult(stream string, process bool, err error) ExtractorResult {
@@ -41,11 +48,25 @@ func NewExtractorResult(stream string, process bool, err error) ExtractorResult
 		stream,
 		process,
 		err,
+		Origin{},
+		false,
 	}
 }
 
+// Return a copy of the result marked as coming from `origin`.
+func (e ExtractorResult) WithOrigin(origin Origin) ExtractorResult {
+	e.origin = origin
+	return e
+}
+
+// Return a copy of the result marked as partially decoded or not.
+func (e ExtractorResult) WithPartial(partial bool) ExtractorResult {
+	e.partial = partial
+	return e
+}
+
 func (e ExtractorResult) ToProcessorResult() ProcessorResult {
-	return NewProcessorResult(e.stream, e.err)
+	return NewProcessorResult(e.stream, e.err).WithOrigin(e.origin).WithPartial(e.partial)
 }
 
 func (e ExtractorResult) String() string {
@@ -42,3 +42,8 @@ func ImageOnlyFilter(in <-chan pdfobjects.PdfObject, out chan<- pdfobjects.PdfOb
 func ObjStmOnlyFilter(in <-chan pdfobjects.PdfObject, out chan<- pdfobjects.PdfObject) {
 	filter(in, out, func(po pdfobjects.PdfObject) bool { return po.GetType() == pdftypes.OBJSTM })
 }
+
+// Removes all objects except objects not referenced by the document.
+func OrphansOnlyFilter(in <-chan pdfobjects.PdfObject, out chan<- pdfobjects.PdfObject) {
+	filter(in, out, func(po pdfobjects.PdfObject) bool { return po.Reachability() == pdfobjects.ORPHANED })
+}
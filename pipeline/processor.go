@@ -14,16 +14,48 @@ func runProcessorStage(f ProcessorFunction, in <-chan ExtractorResult, out chan<
 	f(in, out, cmap)
 }
 
+// Marker preceding the text of streams that were only partially decoded.
+const PARTIAL_MARKER = "[partially decoded]"
+
 type ProcessorResult struct {
 	stream string
 	err error
+	origin Origin
+	partial bool
 }
 
 func NewProcessorResult(stream string, err error) ProcessorResult {
 	return ProcessorResult{
 		stream,
 		err,
+		Origin{},
+		false,
+	}
+}
+
+// Return a copy of the result marked as coming from `origin`.
+func (p ProcessorResult) WithOrigin(origin Origin) ProcessorResult {
+	p.origin = origin
+	return p
+}
+
+// Return a copy of the result marked as partially decoded or not.
+func (p ProcessorResult) WithPartial(partial bool) ProcessorResult {
+	p.partial = partial
+	return p
+}
+
+// Get the text of the result, preceded by the marker of its origin if any
+// and by a marker if its stream was only partially decoded.
+func (p ProcessorResult) String() string {
+	stream := p.stream
+	if p.partial {
+		stream = PARTIAL_MARKER + " " + stream
+	}
+	if marker := p.origin.Marker(); marker != "" {
+		return marker + " " + stream
 	}
+	return stream
 }
 
 func transform(hex_buffer []byte, cmap *pdfobjects.CMap) string {
@@ -88,7 +120,7 @@ func CMapProcessor(in <-chan ExtractorResult, out chan<- ProcessorResult, cmap *
 	defer close(out)
 	for data := range in {
 		if data.process {
-			out <- mapCharacters(data, cmap)
+			out <- mapCharacters(data, cmap).WithOrigin(data.origin).WithPartial(data.partial)
 		} else {
 			out <- data.ToProcessorResult()
 		}
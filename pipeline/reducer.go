@@ -8,18 +8,17 @@ import (
 )
 
 // Type signature for functions for the reducer step.
-type ReducerFunction func (out []chan ProcessorResult, original *pdfobjects.Pdf)
+type ReducerFunction func (out []chan ProcessorResult, original *pdfobjects.Pdf) error
 
 
 // Collects all extracted data and prints it to STDIN.
-func PrintingReducer(out []chan ProcessorResult, original *pdfobjects.Pdf) {
+func PrintingReducer(out []chan ProcessorResult, original *pdfobjects.Pdf) error {
 	strings := make([]string, 0)
 
 	for i := range out {
 		for obj := range out[i] {
-			text := obj.stream
-			if text != "" && obj.err == nil {
-				strings = append(strings, text)
+			if obj.stream != "" && obj.err == nil {
+				strings = append(strings, obj.String())
 			}
 		}
 	}
@@ -29,22 +28,39 @@ func PrintingReducer(out []chan ProcessorResult, original *pdfobjects.Pdf) {
 			fmt.Println(str)
 		}
 	}
+
+	return nil
 }
 
 // Collects all extracted data and writes it to a file.
-func WritingReducer(out []chan ProcessorResult, original *pdfobjects.Pdf) {
+func WritingReducer(out []chan ProcessorResult, original *pdfobjects.Pdf) error {
 	file_name := original.Name() + ".txt"
 	fp, err := os.Create(file_name)
-	check(err)
+	if err != nil {
+		drain(out)
+		return err
+	}
 
 	defer fp.Close()
 
 	for i := range out {
 		for obj := range out[i] {
-			text := obj.stream
-			if text != "" && obj.err == nil {
-				fp.WriteString(text + "\n")
+			if obj.stream != "" && obj.err == nil {
+				if _, err := fp.WriteString(obj.String() + "\n"); err != nil {
+					drain(out)
+					return err
+				}
 			}
 		}
 	}
+
+	return nil
+}
+
+// Discard the remaining results, so the processing stage can finish.
+func drain(out []chan ProcessorResult) {
+	for i := range out {
+		for range out[i] {
+		}
+	}
 }
@@ -1,5 +1,34 @@
 package pipeline
 
+import (
+	"fmt"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdfobjects"
+)
+
 type Result interface {
 	GetStream() string
 }
+
+// Where the text of a result came from.
+type Origin struct {
+	Superseded bool
+	Revision int
+}
+
+// Get the origin of the text extracted from `pobj`.
+func NewOrigin(pobj pdfobjects.PdfObject) Origin {
+	return Origin{
+		pobj.IsSuperseded(),
+		pobj.Revision(),
+	}
+}
+
+// Marker written before text from objects replaced or deleted by a later
+// revision. Text from current objects has no marker.
+func (o Origin) Marker() string {
+	if !o.Superseded {
+		return ""
+	}
+	return fmt.Sprintf("[superseded, revision %d]", o.Revision)
+}
@@ -1,37 +1,96 @@
 package pipeline
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"runtime"
 	"sync"
 
 	"git.magenta.dk/os2datascanner/pdfanalyzer/parser"
 	"git.magenta.dk/os2datascanner/pdfanalyzer/pdfobjects"
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
 )
 
 // General interface for a pipeline.
 type Pipeline interface {
-	 Run(FilterFunction, ExtractorFunction, ProcessorFunction, ReducerFunction)
+	 Run(FilterFunction, ExtractorFunction, ProcessorFunction, ReducerFunction) error
+	 // Get the text entries of the document information dictionary, as
+	 // returned by `Pdf.DocumentInfo`. Empty until `Run` has read the document.
+	 DocumentInfo() map[string]string
 }
 
 // Container for pipeline.
 type ConcurrentPipeline struct {
 	reader *parser.PdfReader
 	pdf *pdfobjects.Pdf
+	info map[string]string
 }
 
+// Range of object indices from `First` up to, but not including, `Last`.
 type indexRange struct {
 	First int
 	Last int
 }
 
-// Returns a new Pipeline struct.
-func NewConcurrentPipeline(file_name string) (Pipeline, error) {
+// Returns a new Pipeline struct for the file `file_name`.
+// With `repair`, the file is read in repair mode, so that as much text as
+// possible is extracted from broken files instead of failing on them.
+func NewConcurrentPipeline(file_name string, repair bool) (Pipeline, error) {
 	reader, err := parser.NewPdfReader(file_name)
-	return ConcurrentPipeline{
+	if err != nil {
+		return nil, err
+	}
+
+	return newConcurrentPipeline(reader, repair), nil
+}
+
+// Returns a new Pipeline struct for the document of `size` bytes in `source`.
+// `name` identifies the document in the output. With `repair`, the document
+// is read in repair mode.
+func NewConcurrentPipelineAt(name string, source io.ReaderAt, size int64, repair bool) (Pipeline, error) {
+	reader, err := parser.NewPdfReaderAt(name, source, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return newConcurrentPipeline(reader, repair), nil
+}
+
+// Returns a new Pipeline struct for the document held in `data`.
+// `name` identifies the document in the output. With `repair`, the document
+// is read in repair mode.
+func NewConcurrentPipelineFromBytes(name string, data []byte, repair bool) (Pipeline, error) {
+	reader, err := parser.NewPdfReaderFromBytes(name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return newConcurrentPipeline(reader, repair), nil
+}
+
+// Returns a new Pipeline struct reading with `reader`, in repair mode if
+// `repair` is set.
+func newConcurrentPipeline(reader *parser.PdfReader, repair bool) Pipeline {
+	reader.SetRepairMode(repair)
+
+	return NewConcurrentPipelineFromReader(reader)
+}
+
+// Returns a new Pipeline struct reading the document with `reader`,
+// which can be set up beforehand, e.g. with a password or in lazy mode.
+func NewConcurrentPipelineFromReader(reader *parser.PdfReader) Pipeline {
+	return &ConcurrentPipeline{
 		reader,
-		pdfobjects.NewPdf(file_name),
-	}, err
+		pdfobjects.NewPdf(reader.Name()),
+		make(map[string]string),
+	}
+}
+
+// Get the text entries of the document information dictionary of the
+// document. Entries that cannot be read are left out.
+func (p *ConcurrentPipeline) DocumentInfo() map[string]string {
+	return p.info
 }
 
 // Create index ranges to partition the data with.
@@ -42,10 +101,13 @@ func (p ConcurrentPipeline) partition(cores int) []indexRange {
 
 	for i := 0; i < cores; i++ {
 		first := i * step
-		last := (i + 1) * step - 1
+		last := (i + 1) * step
 		ranges[i] = indexRange{ First: first, Last: last }
 	}
 
+	// The last range also covers the objects left over by the division.
+	ranges[cores-1].Last = p.pdf.Count()
+
 	return ranges
 }
 
@@ -75,28 +137,102 @@ func generateChannels(cores int, nobjects int)(
 	return gen, fil, ext, pro, fin
 }
 
-func fillChannel(pdf *pdfobjects.Pdf, out chan pdfobjects.PdfObject, index indexRange) {
+// Stops the stages of a pipeline at the first exceeded limit.
+// Safe for concurrent use.
+type stopper struct {
+	once sync.Once
+	stopped chan struct{}
+	err error
+}
+
+func newStopper() *stopper {
+	return &stopper{
+		sync.Once{},
+		make(chan struct{}),
+		nil,
+	}
+}
+
+// Stop the pipeline with `err`, unless it has already been stopped.
+func (s *stopper) stop(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.stopped)
+	})
+}
+
+// Check whether the pipeline has been stopped.
+func (s *stopper) isStopped() bool {
+	select {
+	case <-s.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// Pass the objects in `index` on to `out`. In lazy mode, each object is
+// loaded from its reference here, and dropped once it has been processed.
+// Objects that cannot be loaded are skipped, and their errors are collected
+// in `skipped`, which is complete once `out` is closed.
+// No more objects are passed on once `stop` is stopped, and an exceeded
+// limit while loading stops it.
+func fillChannel(pdf *pdfobjects.Pdf, out chan pdfobjects.PdfObject, index indexRange, skipped *[]error, stop *stopper) {
 	defer close(out)
 
-	for i := index.First; i < index.Last; i++ {
-		data, err := pdf.GetObject(i)
-		check(err)
+	for i := index.First; i < index.Last && !stop.isStopped(); i++ {
+		data, err := pdf.ObjectAt(i)
+		if errors.Is(err, pdftypes.ErrLimitExceeded) {
+			stop.stop(err)
+			return
+		}
+		if err != nil {
+			*skipped = append(*skipped, err)
+			continue
+		}
 
 		out <- *data
 	}
 }
 
+// Pass the extracted results from `in` on to `out`, stopping the pipeline
+// with the first result whose error is an exceeded limit.
+func watchLimits(in <-chan ExtractorResult, out chan<- ExtractorResult, stop *stopper, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer close(out)
+
+	for result := range in {
+		if errors.Is(result.err, pdftypes.ErrLimitExceeded) {
+			stop.stop(result.err)
+		}
+		out <- result
+	}
+}
+
 // Run a concurrent pipeline.
-func (p ConcurrentPipeline) Run(
+// Returns an error if the document cannot be read or the result cannot be
+// reduced. An exceeded limit, including the timeout, stops the pipeline
+// before the reduction and its error of kind `LIMIT_ERROR` is returned.
+func (p *ConcurrentPipeline) Run(
 	filter FilterFunction,
 	extract ExtractorFunction,
 	process ProcessorFunction,
 	reduce ReducerFunction,
-) {
+) error {
 	fmt.Println("Running Pipeline for file:", p.pdf.Name())
 
 	// Read and parse the pdf document using a single core.
-	p.pdf = p.reader.ReadAll()
+	// In lazy mode, objects are instead loaded as they are passed on.
+	pdf, err := p.reader.ReadAll()
+	if err != nil {
+		return err
+	}
+	defer p.reader.Close()
+	p.pdf = pdf
+
+	if info, err := p.pdf.DocumentInfo(); err == nil {
+		p.info = info
+	}
 
 	// Get the number of available cores on the system.
 	cores := runtime.NumCPU()
@@ -112,15 +248,31 @@ func (p ConcurrentPipeline) Run(
 	var wg sync.WaitGroup
 	wg.Add(cores)
 
+	// Errors of the objects each core could not load.
+	skipped := make([][]error, cores)
+	stop := newStopper()
+
 	// Start filling channels, filtering and extraction as goroutines.
 	for i := 0; i < cores; i++ {
-		go fillChannel(p.pdf, gen[i], ranges[i])
+		extracted := make(chan ExtractorResult)
+		go fillChannel(p.pdf, gen[i], ranges[i], &skipped[i], stop)
 		go runFilterStage(filter, gen[i], fil[i])
-		go runExtractorStage(extract, fil[i], ext[i], &cmap, &wg)
+		go runExtractorStage(extract, fil[i], extracted, &cmap)
+		go watchLimits(extracted, ext[i], stop, &wg)
 	}
 
 	// Wait for extraction to finish in case cmaps are last.
 	wg.Wait()
+
+	if stop.err != nil {
+		return stop.err
+	}
+
+	for _, errs := range skipped {
+		for _, err := range errs {
+			p.pdf.AddRepair("Skipped unreadable object", err)
+		}
+	}
 	
 	// Start processing stage as goroutines
 	for i := 0; i < cores; i++ {
@@ -128,15 +280,19 @@ func (p ConcurrentPipeline) Run(
 	}
 
 	// Reduce the result.
-	reduce(pro, p.pdf)
+	if err := reduce(pro, p.pdf); err != nil {
+		return err
+	}
+
+	if repairs := p.pdf.Repairs(); len(repairs) > 0 {
+		fmt.Printf("Pipeline ran successfully! %d repairs were made:\n", len(repairs))
+		for _, repair := range repairs {
+			fmt.Println(" -", repair)
+		}
+		return nil
+	}
 
 	fmt.Println("Pipeline ran successfully! No errors reported.")
-}
 
-// In case of error just print the error and panic.
-func check(err error) {
-	if err != nil {
-		fmt.Println(err)
-		panic(err)
-	}
+	return nil
 }
@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"git.magenta.dk/os2datascanner/pdfanalyzer/parser"
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdfobjects"
+	"git.magenta.dk/os2datascanner/pdfanalyzer/pdftypes"
+)
+
+const TEST_FILE = "../assets/gcc.pdf"
+
+// Run a pipeline over `file_name` with `limits`, collecting the text.
+func runWithLimits(t *testing.T, file_name string, lazy bool, limits pdfobjects.Limits) ([]string, bool, error) {
+	t.Helper()
+
+	reader, err := parser.NewPdfReader(file_name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.SetLazyMode(lazy)
+	reader.SetLimits(limits)
+
+	text := make([]string, 0)
+	reduced := false
+	collect := func(out []chan ProcessorResult, original *pdfobjects.Pdf) error {
+		reduced = true
+		for i := range out {
+			for obj := range out[i] {
+				if obj.stream != "" && obj.err == nil {
+					text = append(text, obj.String())
+				}
+			}
+		}
+		return nil
+	}
+
+	err = NewConcurrentPipelineFromReader(reader).Run(TextOnlyFilter, SimpleExtractor, CMapProcessor, collect)
+	return text, reduced, err
+}
+
+func TestRunDefaultLimits(t *testing.T) {
+	for _, lazy := range []bool{false, true} {
+		text, _, err := runWithLimits(t, TEST_FILE, lazy, pdfobjects.DefaultLimits())
+		if err != nil {
+			t.Errorf("lazy %v: %v", lazy, err)
+		}
+		if len(text) == 0 {
+			t.Errorf("lazy %v: no text extracted", lazy)
+		}
+	}
+}
+
+func TestRunExceededLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		limits pdfobjects.Limits
+	}{
+		{"stream size", pdfobjects.Limits{MaxStreamSize: 1000}},
+		{"decoded bytes", pdfobjects.Limits{MaxDecodedBytes: 1600000}},
+		{"depth", pdfobjects.Limits{MaxDepth: 1}},
+		{"objects", pdfobjects.Limits{MaxObjects: 100}},
+		{"timeout", pdfobjects.Limits{Timeout: time.Nanosecond}},
+	}
+
+	for _, test := range tests {
+		for _, lazy := range []bool{false, true} {
+			_, reduced, err := runWithLimits(t, TEST_FILE, lazy, test.limits)
+
+			var pdf_err *pdftypes.PdfError
+			if !errors.As(err, &pdf_err) || pdf_err.Kind != pdftypes.LIMIT_ERROR || !errors.Is(err, pdftypes.ErrLimitExceeded) {
+				t.Errorf("%s, lazy %v: expected limit error, got %v", test.name, lazy, err)
+			}
+			if reduced {
+				t.Errorf("%s, lazy %v: results reduced despite the exceeded limit", test.name, lazy)
+			}
+		}
+	}
+}
+
+// A timeout during extraction stops the pipeline, and no more objects are
+// passed on afterwards.
+func TestWatchLimits(t *testing.T) {
+	timeout := pdftypes.Errorf(pdftypes.LIMIT_ERROR, -1, "%w: Timeout of 1s exceeded", pdftypes.ErrLimitExceeded)
+
+	in := make(chan ExtractorResult, 2)
+	out := make(chan ExtractorResult, 2)
+	in <- NewExtractorResult("text", false, nil)
+	in <- NewExtractorResult("", false, timeout)
+	close(in)
+
+	stop := newStopper()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	watchLimits(in, out, stop, &wg)
+
+	if stop.err != timeout || len(out) != 2 {
+		t.Errorf("Expected the pipeline to stop with %v, got %v", timeout, stop.err)
+	}
+
+	pdf := pdfobjects.NewPdf("test.pdf")
+	pdf.AppendObject(pdfobjects.NewPdfObject())
+	objects := make(chan pdfobjects.PdfObject, 1)
+	skipped := make([]error, 0)
+	fillChannel(pdf, objects, indexRange{0, 1}, &skipped, stop)
+
+	if len(objects) != 0 {
+		t.Errorf("Objects passed on after the pipeline stopped")
+	}
+}
+
+// The document information is returned, not printed.
+func TestDocumentInfo(t *testing.T) {
+	pipe, err := NewConcurrentPipeline(TEST_FILE, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := pipe.DocumentInfo(); len(info) != 0 {
+		t.Errorf("Document information before Run: %v", info)
+	}
+
+	discard := func(out []chan ProcessorResult, original *pdfobjects.Pdf) error {
+		drain(out)
+		return nil
+	}
+	if err := pipe.Run(TextOnlyFilter, SimpleExtractor, CMapProcessor, discard); err != nil {
+		t.Fatal(err)
+	}
+
+	if producer := pipe.DocumentInfo()["Producer"]; producer != "pdfTeX-1.40.19" {
+		t.Errorf("Producer %q, expected pdfTeX-1.40.19", producer)
+	}
+}